@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/iamolegga/lana/internal/admin"
+)
+
+const adminUsage = `Usage: lana admin <command> [flags] [arguments]
+
+Commands:
+  upload <host> <dir|archive>  upload login assets (a directory is zipped) and serve them
+  versions <host>              list a host's login asset versions
+  rollback <host> [version]    serve an earlier login asset version (default: the one before the active)
+  hosts [host]                 list hosts, or describe one with its active login assets
+  revoke <client>              lift a rate-limit ban (on the replica that answers)
+
+Flags:
+`
+
+// adminFlags are the flags shared by every admin command.
+type adminFlags struct {
+	addr   string
+	json   bool
+	client admin.ClientOptions
+}
+
+func newAdminFlagSet(f *adminFlags) *flag.FlagSet {
+	fs := flag.NewFlagSet("lana admin", flag.ContinueOnError)
+	fs.StringVar(&f.addr, "addr", envOr("LANA_ADMIN_ADDR", "localhost:8081"), "admin listener address or URL (env LANA_ADMIN_ADDR)")
+	fs.StringVar(&f.client.Token, "token", os.Getenv("LANA_ADMIN_TOKEN"), "bearer token or JWT (env LANA_ADMIN_TOKEN)")
+	fs.StringVar(&f.client.CertFile, "cert", "", "client certificate (PEM) for mutual TLS")
+	fs.StringVar(&f.client.KeyFile, "key", "", "private key of -cert")
+	fs.StringVar(&f.client.CAFile, "cacert", "", "CA (PEM) verifying the admin listener's certificate")
+	fs.BoolVar(&f.json, "json", false, "print the API response as JSON")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), adminUsage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// runAdmin runs `lana admin` with args and returns the exit code.
+func runAdmin(args []string) int {
+	var f adminFlags
+	fs := newAdminFlagSet(&f)
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fs.Usage()
+		return 2
+	}
+	command := args[0]
+	args, err := parseInterspersed(fs, args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		return 2
+	}
+
+	client, err := admin.NewClient(f.addr, f.client)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lana admin: %v\n", err)
+		return 1
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	cmd := adminCommand{client: client, out: os.Stdout, json: f.json}
+	switch {
+	case command == "upload" && len(args) == 2:
+		err = cmd.upload(ctx, args[0], args[1])
+	case command == "versions" && len(args) == 1:
+		err = cmd.versions(ctx, args[0])
+	case command == "rollback" && (len(args) == 1 || len(args) == 2):
+		err = cmd.rollback(ctx, args[0], args[1:])
+	case command == "hosts" && len(args) <= 1:
+		err = cmd.hosts(ctx, args)
+	case command == "revoke" && len(args) == 1:
+		err = cmd.revoke(ctx, args[0])
+	default:
+		fs.Usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lana admin %s: %v\n", command, err)
+		return 1
+	}
+	return 0
+}
+
+// parseInterspersed parses fs from args, allowing flags after positional
+// arguments, and returns the positional arguments.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		if args[0] == "--" {
+			return append(positional, args[1:]...), nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+type adminCommand struct {
+	client *admin.Client
+	out    io.Writer
+	json   bool
+}
+
+func (c adminCommand) upload(ctx context.Context, host, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	var resp *admin.UploadResponse
+	if info.IsDir() {
+		resp, err = c.client.UploadDir(ctx, host, path)
+	} else {
+		resp, err = c.client.UploadFile(ctx, host, path)
+	}
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(resp)
+	}
+	fmt.Fprintf(c.out, "uploaded version %d of %s\n", resp.Version.ID, host)
+	if resp.Report == nil {
+		return nil
+	}
+	fmt.Fprintf(c.out, "%d files, %d bytes\n", len(resp.Report.Files), resp.Report.Bytes)
+	if resp.Report.StrippedDir != "" {
+		fmt.Fprintf(c.out, "stripped top-level directory %s/\n", resp.Report.StrippedDir)
+	}
+	return nil
+}
+
+func (c adminCommand) versions(ctx context.Context, host string) error {
+	versions, err := c.client.Versions(ctx, host)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(versions)
+	}
+	tw := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tCREATED\tBYTES\tACTIVE")
+	for _, v := range versions {
+		active := ""
+		if v.Active {
+			active = "*"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%s\n", v.ID, v.CreatedAt.Local().Format("2006-01-02 15:04:05"), v.Bytes, active)
+	}
+	return tw.Flush()
+}
+
+func (c adminCommand) rollback(ctx context.Context, host string, args []string) error {
+	var id int
+	if len(args) == 1 {
+		var err error
+		if id, err = strconv.Atoi(args[0]); err != nil || id <= 0 {
+			return fmt.Errorf("invalid version %q", args[0])
+		}
+	} else {
+		versions, err := c.client.Versions(ctx, host)
+		if err != nil {
+			return err
+		}
+		if id = previousVersion(versions); id == 0 {
+			return errors.New("no version before the active one")
+		}
+	}
+
+	version, err := c.client.Activate(ctx, host, id)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(version)
+	}
+	fmt.Fprintf(c.out, "serving version %d of %s\n", version.ID, host)
+	return nil
+}
+
+// previousVersion returns the newest version older than the active one, or
+// 0 if there is none.
+func previousVersion(versions []admin.Version) int {
+	active := 0
+	for _, v := range versions {
+		if v.Active {
+			active = v.ID
+		}
+	}
+	previous := 0
+	for _, v := range versions {
+		if v.ID < active && v.ID > previous {
+			previous = v.ID
+		}
+	}
+	return previous
+}
+
+func (c adminCommand) hosts(ctx context.Context, args []string) error {
+	if len(args) == 1 {
+		host, err := c.client.Host(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		if c.json {
+			return c.printJSON(host)
+		}
+		return c.printHost(host)
+	}
+
+	hosts, err := c.client.Hosts(ctx)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(hosts)
+	}
+	tw := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "HOST\tSOURCE\tPROVIDERS\tKID\tKEY FINGERPRINT")
+	for _, h := range hosts {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			h.Name, h.Source, strings.Join(h.Providers, ","), h.JWT.KeyID, h.JWT.KeyFingerprint)
+	}
+	return tw.Flush()
+}
+
+func (c adminCommand) printHost(h *admin.HostInfo) error {
+	tw := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Host:\t%s\n", h.Name)
+	fmt.Fprintf(tw, "Source:\t%s\n", h.Source)
+	fmt.Fprintf(tw, "Providers:\t%s\n", strings.Join(h.Providers, ", "))
+	fmt.Fprintf(tw, "Redirect URLs:\t%s\n", strings.Join(h.AllowedRedirectURLs, ", "))
+	if h.LoginDir != "" {
+		fmt.Fprintf(tw, "Login dir:\t%s\n", h.LoginDir)
+	}
+	fmt.Fprintf(tw, "JWT:\taud=%s expiry=%s kid=%s alg=%s\n", h.JWT.Audience, h.JWT.Expiry, h.JWT.KeyID, h.JWT.Algorithm)
+	fmt.Fprintf(tw, "Key fingerprint:\t%s\n", h.JWT.KeyFingerprint)
+	if h.Assets != nil && h.Assets.ActiveVersion != nil {
+		fmt.Fprintf(tw, "Active version:\t%d\n", h.Assets.ActiveVersion.ID)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if h.Assets == nil || len(h.Assets.Files) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(c.out)
+	tw = tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FILE\tBYTES\tSHA256")
+	for _, file := range h.Assets.Files {
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", file.Path, file.Bytes, file.SHA256)
+	}
+	return tw.Flush()
+}
+
+func (c adminCommand) revoke(ctx context.Context, client string) error {
+	if err := c.client.ClearBan(ctx, client); err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(admin.StatusResponse{Status: "ok"})
+	}
+	fmt.Fprintf(c.out, "lifted ban of %s\n", client)
+	return nil
+}
+
+func (c adminCommand) printJSON(v any) error {
+	enc := json.NewEncoder(c.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
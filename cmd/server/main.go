@@ -1,13 +1,19 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"net/netip"
 	"os"
+	"time"
 
+	"github.com/iamolegga/lana/internal/admin"
+	"github.com/iamolegga/lana/internal/clientinfo"
 	"github.com/iamolegga/lana/internal/config"
+	"github.com/iamolegga/lana/internal/i18n"
 	"github.com/iamolegga/lana/internal/logging"
 	"github.com/iamolegga/lana/internal/metrics"
 	"github.com/iamolegga/lana/internal/oauth"
@@ -16,12 +22,18 @@ import (
 	"github.com/iamolegga/lana/internal/providers/google"
 	xprovider "github.com/iamolegga/lana/internal/providers/x"
 	"github.com/iamolegga/lana/internal/ratelimit"
+	"github.com/iamolegga/lana/internal/redisconn"
 	"github.com/iamolegga/lana/internal/server"
+	"github.com/iamolegga/lana/internal/statestore"
+	"github.com/iamolegga/lana/internal/tracing"
 )
 
-var configPath string
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "admin" {
+		os.Exit(runAdmin(os.Args[2:]))
+	}
 
-func init() {
+	var configPath string
 	flag.StringVar(
 		&configPath,
 		"config",
@@ -29,9 +41,7 @@ func init() {
 		"path to the config file",
 	)
 	flag.Parse()
-}
 
-func main() {
 	server.SubscribeForShutdown()
 
 	cfg, err := config.New(configPath)
@@ -47,12 +57,98 @@ func main() {
 	// observability listener exposes /metrics.
 	metrics.Init(cfg.Observability.Metrics.Enabled, cfg.Observability.Metrics.GoMetrics)
 
-	limiterConfig := ratelimit.Config{
-		RequestsPerMinute:  cfg.RateLimit.RequestsPerMinute,
-		CleanupInterval:    cfg.RateLimit.CleanupInterval,
+	shutdownTracing, err := tracing.Setup(server.GetServerBaseContext(), cfg.Observability.Tracing)
+	if err != nil {
+		slog.Error("failed to set up tracing", "error", err)
+		os.Exit(1)
+	}
+
+	var trustedProxies []netip.Prefix
+	for _, cidr := range cfg.Server.TrustedProxies {
+		// Already validated by the config loader.
+		trustedProxies = append(trustedProxies, netip.MustParsePrefix(cidr))
+	}
+	clientInfo := clientinfo.New(clientinfo.Config{
+		TrustedProxies:     trustedProxies,
+		ClientIPHeader:     cfg.Server.ClientIPHeader,
 		XForwardedForIndex: cfg.RateLimit.XForwardedForIndex,
+	})
+
+	hostLocales := make(map[string]string, len(cfg.Hosts))
+	for hostname, hostConfig := range cfg.Hosts {
+		hostLocales[hostname] = hostConfig.Locale
+	}
+	messages, err := i18n.New(i18n.Config{
+		DefaultLocale: cfg.I18n.DefaultLocale,
+		CatalogDir:    cfg.I18n.CatalogDir,
+		HostLocales:   hostLocales,
+	})
+	if err != nil {
+		slog.Error("failed to load message catalogs", "error", err)
+		os.Exit(1)
 	}
-	limiter := ratelimit.New(server.GetServerBaseContext(), limiterConfig, nil)
+
+	limiterConfig := ratelimit.Config{
+		RequestsPerMinute: cfg.RateLimit.RequestsPerMinute,
+		CleanupInterval:   cfg.RateLimit.CleanupInterval,
+		ClientInfo:        clientInfo,
+		IPv6Prefix:        cfg.RateLimit.IPv6Prefix,
+		ErrorPage:         cfg.RateLimit.ErrorPage,
+		Messages:          messages,
+		Bans: ratelimit.BanConfig{
+			Enabled:   cfg.RateLimit.Ban.Enabled,
+			Threshold: cfg.RateLimit.Ban.Threshold,
+			Window:    cfg.RateLimit.Ban.Window,
+			Duration:  cfg.RateLimit.Ban.Duration,
+		},
+	}
+	for _, rule := range cfg.RateLimit.Rules {
+		limiterConfig.Rules = append(limiterConfig.Rules, ratelimit.Rule{
+			Name:    rule.Name,
+			Hosts:   rule.Hosts,
+			Methods: rule.Methods,
+			Paths:   rule.Paths,
+			Rate: ratelimit.Rate{
+				PerMinute: rule.RequestsPerMinute,
+				Burst:     rule.Burst,
+			},
+			Key: ratelimit.KeyBy(rule.Key),
+		})
+	}
+	for _, cidr := range cfg.RateLimit.Allowlist {
+		// Already validated by the config loader.
+		limiterConfig.Allowlist = append(limiterConfig.Allowlist, netip.MustParsePrefix(cidr))
+	}
+
+	var limiterStore ratelimit.Store
+	if cfg.RateLimit.Backend == "redis" {
+		limiterStore = ratelimit.NewRedisStore(
+			redisconn.New(cfg.RateLimit.Redis),
+			cfg.RateLimit.Redis.KeyPrefix,
+			cfg.RateLimit.Redis.Timeout,
+		)
+		slog.Info("using shared rate limit store", "addr", cfg.RateLimit.Redis.Addr)
+	}
+	limiter := ratelimit.New(server.GetServerBaseContext(), limiterConfig, limiterStore)
+
+	var stateStore statestore.Store
+	switch cfg.State.Store {
+	case "memory":
+		stateStore = statestore.NewMemory(server.GetServerBaseContext(), time.Minute)
+	case "sqlite":
+		stateStore, err = statestore.NewSQLite(server.GetServerBaseContext(), cfg.State.SQLite.Path, time.Minute)
+		if err != nil {
+			slog.Error("failed to open state store", "error", err)
+			os.Exit(1)
+		}
+	case "redis":
+		stateStore = statestore.NewRedis(
+			redisconn.New(cfg.State.Redis),
+			cfg.State.Redis.KeyPrefix,
+			cfg.State.Redis.Timeout,
+		)
+	}
+	slog.Info("using state store", "store", cfg.State.Store)
 
 	registry := oauth.NewRegistry()
 	registry.Register("google", google.New)
@@ -60,15 +156,36 @@ func main() {
 	registry.Register("x", xprovider.New)
 	registry.Register("apple", apple.New)
 
+	var hostStore *admin.HostStore
+	var storedHosts map[string]config.HostConfig
+	if cfg.Admin.Enabled && cfg.Admin.HostStoreDir != "" {
+		hostStore = admin.NewHostStore(cfg.Admin.HostStoreDir)
+		storedHosts, err = hostStore.Load()
+		if err != nil {
+			slog.Error("failed to load stored hosts", "error", err)
+			os.Exit(1)
+		}
+		slog.Info("loaded stored hosts", "count", len(storedHosts))
+	}
+
 	srv, err := server.New(server.Config{
 		Config:      cfg,
 		RateLimiter: limiter,
 		Registry:    registry,
+		ClientInfo:  clientInfo,
+		I18n:        messages,
+		StateStore:  stateStore,
+		StoredHosts: storedHosts,
 	})
 	if err != nil {
 		slog.Error("failed to initialize server", "error", err)
 		os.Exit(1)
 	}
+	limiter.SetHosts(srv)
+
+	if hostStore != nil {
+		go srv.WatchHostStore(server.GetServerBaseContext(), hostStore, cfg.Admin.HostStoreSyncInterval)
+	}
 
 	go func() {
 		slog.Info("starting HTTP server", "port", cfg.Server.Port)
@@ -78,7 +195,17 @@ func main() {
 		}
 	}()
 
-	adminHTTP := server.NewAdminServer(cfg, srv.LoginDirs())
+	adminHTTP, err := server.NewAdminServer(server.AdminConfig{
+		Config:    cfg,
+		LoginDirs: srv.LoginDirs(),
+		Bans:      limiter.Bans(),
+		Hosts:     srv,
+		HostStore: hostStore,
+	})
+	if err != nil {
+		slog.Error("failed to initialize admin server", "error", err)
+		os.Exit(1)
+	}
 	if adminHTTP != nil {
 		go func() {
 			if err := server.StartAdmin(adminHTTP); err != nil && err != http.ErrServerClosed {
@@ -98,4 +225,11 @@ func main() {
 
 	slog.Info("server started successfully", "port", cfg.Server.Port)
 	server.WaitForShutdown(srv.GetHTTPServer(), adminHTTP, obsHTTP)
+
+	// Flush spans still buffered by the exporter.
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Error("failed to flush traces", "error", err)
+	}
 }
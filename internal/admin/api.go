@@ -0,0 +1,50 @@
+package admin
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Admin API routes, shared by the admin server's mux and Client so the two
+// cannot drift apart.
+const (
+	RouteLoginAssets     = "/admin/login-assets/{host}"
+	RouteLoginAssetFile  = "/admin/login-assets/{host}/files/{path...}"
+	RouteVersions        = "/admin/login-assets/{host}/versions"
+	RouteVersion         = "/admin/login-assets/{host}/versions/{version}"
+	RouteVersionActivate = "/admin/login-assets/{host}/versions/{version}/activate"
+	RouteHosts           = "/admin/hosts"
+	RouteHost            = "/admin/hosts/{host}"
+	RouteConfig          = "/admin/config"
+	RouteBans            = "/admin/bans"
+	RouteBan             = "/admin/bans/{client...}"
+)
+
+// StatusResponse is returned by admin endpoints that have nothing else to
+// report.
+type StatusResponse struct {
+	Status string `json:"status"`
+}
+
+// routePath fills the wildcards of route with values, in order. Values of
+// trailing "{name...}" wildcards may contain slashes.
+func routePath(route string, values ...string) string {
+	segments := strings.Split(route, "/")
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, "{") || len(values) == 0 {
+			continue
+		}
+		value := values[0]
+		values = values[1:]
+		if strings.HasSuffix(segment, "...}") {
+			parts := strings.Split(value, "/")
+			for j, part := range parts {
+				parts[j] = url.PathEscape(part)
+			}
+			segments[i] = strings.Join(parts, "/")
+			continue
+		}
+		segments[i] = url.PathEscape(value)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,251 @@
+package admin
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// APIError is an error response from the admin API.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("admin API: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("admin API: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// ClientOptions configures how a Client authenticates.
+type ClientOptions struct {
+	// Token is sent as a bearer token: a static admin token or a JWT.
+	Token string
+	// CertFile and KeyFile are a client certificate for mutual TLS.
+	CertFile string
+	KeyFile  string
+	// CAFile verifies the admin listener's certificate instead of the
+	// system roots.
+	CAFile string
+}
+
+// Client calls the admin API.
+type Client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// NewClient returns a client for the admin listener at addr, a URL or a
+// host:port. A host:port is reached over HTTPS when a certificate or CA is
+// configured, and over HTTP otherwise.
+func NewClient(addr string, opts ClientOptions) (*Client, error) {
+	useTLS := opts.CertFile != "" || opts.CAFile != ""
+	if !strings.Contains(addr, "://") {
+		if useTLS {
+			addr = "https://" + addr
+		} else {
+			addr = "http://" + addr
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if useTLS {
+		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+		if opts.CertFile != "" {
+			cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("load client certificate: %w", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+		if opts.CAFile != "" {
+			pemData, err := os.ReadFile(opts.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("read CA file: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pemData) {
+				return nil, fmt.Errorf("no certificates found in CA file %s", opts.CAFile)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return &Client{
+		baseURL: strings.TrimSuffix(addr, "/"),
+		token:   opts.Token,
+		http:    &http.Client{Transport: transport},
+	}, nil
+}
+
+// UploadDir zips dir and uploads it as the host's new login assets.
+// Symlinks inside dir are rejected, as the server would reject them.
+func (c *Client) UploadDir(ctx context.Context, host, dir string) (*UploadResponse, error) {
+	dir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := HasIndex(dir); err != nil {
+		return nil, err
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeZip(pw, dir))
+	}()
+	defer pr.Close()
+	return c.Upload(ctx, host, pr, "application/zip")
+}
+
+// UploadFile uploads a zip, tar, tar.gz or tar.zst archive as the host's new
+// login assets. The server detects the format.
+func (c *Client) UploadFile(ctx context.Context, host, path string) (*UploadResponse, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return c.Upload(ctx, host, f, "application/octet-stream")
+}
+
+// Upload uploads an archive as the host's new login assets.
+func (c *Client) Upload(ctx context.Context, host string, body io.Reader, contentType string) (*UploadResponse, error) {
+	var resp UploadResponse
+	err := c.do(ctx, http.MethodPost, routePath(RouteLoginAssets, host), body, contentType, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Versions lists the host's login asset versions, oldest first.
+func (c *Client) Versions(ctx context.Context, host string) ([]Version, error) {
+	var versions []Version
+	if err := c.do(ctx, http.MethodGet, routePath(RouteVersions, host), nil, "", &versions); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// Activate serves version id of the host's login assets.
+func (c *Client) Activate(ctx context.Context, host string, id int) (*Version, error) {
+	var version Version
+	err := c.do(ctx, http.MethodPost, routePath(RouteVersionActivate, host, strconv.Itoa(id)), nil, "", &version)
+	if err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// Hosts describes the hosts the caller may see.
+func (c *Client) Hosts(ctx context.Context) ([]HostInfo, error) {
+	var hosts []HostInfo
+	if err := c.do(ctx, http.MethodGet, RouteHosts, nil, "", &hosts); err != nil {
+		return nil, err
+	}
+	return hosts, nil
+}
+
+// Host describes one host, including its active login assets.
+func (c *Client) Host(ctx context.Context, name string) (*HostInfo, error) {
+	var host HostInfo
+	if err := c.do(ctx, http.MethodGet, routePath(RouteHost, name), nil, "", &host); err != nil {
+		return nil, err
+	}
+	return &host, nil
+}
+
+// ClearBan lifts the rate limiter's ban of client on the replica that
+// answers.
+func (c *Client) ClearBan(ctx context.Context, client string) error {
+	var status StatusResponse
+	return c.do(ctx, http.MethodDelete, routePath(RouteBan, client), nil, "", &status)
+}
+
+// do sends a request and decodes a successful JSON response into out.
+func (c *Client) do(ctx context.Context, method, path string, body io.Reader, contentType string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode %s %s response: %w", method, path, err)
+	}
+	return nil
+}
+
+// writeZip writes the regular files under dir to w as a zip archive.
+func writeZip(w io.Writer, dir string) error {
+	zw := zip.NewWriter(w)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			if d.Type()&fs.ModeSymlink != 0 {
+				return fmt.Errorf("%s: symlinks are not supported", path)
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		header.Method = zip.Deflate
+
+		dst, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(dst, src)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("zip %s: %w", dir, err)
+	}
+	return zw.Close()
+}
@@ -6,73 +6,350 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 )
 
-// ErrUnsafeEntry is returned when a ZIP entry has a path that escapes the
-// destination directory, is absolute, or is a symlink.
-var ErrUnsafeEntry = errors.New("unsafe zip entry")
+var (
+	// ErrUnsafeEntry is returned when an archive entry has a path that
+	// escapes the destination directory, is absolute, or is a link or
+	// special file, or when two entries have the same path.
+	ErrUnsafeEntry = errors.New("unsafe archive entry")
+	// ErrInvalidArchive is returned when the upload is not a readable archive.
+	ErrInvalidArchive = errors.New("invalid archive")
+	// ErrLimitExceeded is returned when an archive exceeds one of the Limits.
+	ErrLimitExceeded = errors.New("upload limit exceeded")
+	// ErrMissingIndex is returned when an archive has no index.html at its
+	// root (after stripping a top-level directory).
+	ErrMissingIndex = errors.New("archive has no index.html")
+	// ErrInvalidPath is returned by WriteFile for a path that is empty,
+	// absolute, escapes the destination directory or names a directory.
+	ErrInvalidPath = errors.New("invalid file path")
+)
 
-// ExtractZip extracts the ZIP at zipPath into destDir. destDir must already
-// exist. Each entry's path is validated to sit under destDir (no ZipSlip),
-// and any symlink entries are rejected.
-func ExtractZip(zipPath, destDir string) error {
-	r, err := zip.OpenReader(zipPath)
+// Limits bound what an upload may expand to. Zero values disable a limit.
+type Limits struct {
+	MaxEntries          int   // files and directories in the archive
+	MaxExtractedBytes   int64 // total uncompressed size
+	MaxCompressionRatio int64 // total uncompressed size / archive size
+}
+
+// ExtractReport describes an extracted archive.
+type ExtractReport struct {
+	Files []ExtractedFile `json:"files"`
+	Bytes int64           `json:"bytes"`
+	// StrippedDir is the single top-level directory whose contents were
+	// moved to the root, if any.
+	StrippedDir string `json:"stripped_dir,omitempty"`
+}
+
+// ExtractedFile is a file written by an extraction.
+type ExtractedFile struct {
+	Path  string `json:"path"`
+	Bytes int64  `json:"bytes"`
+}
+
+// Extract extracts the archive at archivePath, in the given format, into
+// destDir. destDir must already exist and be empty. Each entry's path is
+// validated to sit under destDir (no ZipSlip), and links and special files
+// are rejected. Sizes are enforced while writing, since archive headers
+// cannot be trusted. When everything sits in one top-level directory, that
+// directory is stripped. The result must contain an index.html.
+func Extract(archivePath, destDir string, format Format, limits Limits) (*ExtractReport, error) {
+	info, err := os.Stat(archivePath)
 	if err != nil {
-		return fmt.Errorf("open zip: %w", err)
+		return nil, fmt.Errorf("stat archive: %w", err)
 	}
-	defer r.Close()
+	absDest, err := filepath.Abs(destDir)
+	if err != nil {
+		return nil, fmt.Errorf("resolve destination: %w", err)
+	}
+
+	e := &extraction{
+		dest:       absDest,
+		maxEntries: limits.MaxEntries,
+		budget:     newBudget(limits, info.Size()),
+		report:     &ExtractReport{},
+	}
+	switch format {
+	case FormatZip:
+		err = extractZip(archivePath, e)
+	case FormatTar, FormatTarGzip, FormatTarZstd:
+		err = extractTar(archivePath, format, e)
+	default:
+		err = fmt.Errorf("%w: unsupported format %q", ErrInvalidArchive, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := e.stripSingleDir(); err != nil {
+		return nil, err
+	}
+	if err := HasIndex(absDest); err != nil {
+		return nil, err
+	}
+	return e.report, nil
+}
 
+// HasIndex returns ErrMissingIndex unless dir contains an index.html.
+func HasIndex(dir string) error {
+	info, err := os.Stat(filepath.Join(dir, "index.html"))
+	if err != nil || !info.Mode().IsRegular() {
+		return ErrMissingIndex
+	}
+	return nil
+}
+
+// WriteFile writes src to name, a slash-separated path, under destDir,
+// creating parent directories as needed.
+func WriteFile(destDir, name string, src io.Reader) (ExtractedFile, error) {
 	absDest, err := filepath.Abs(destDir)
 	if err != nil {
-		return fmt.Errorf("resolve destination: %w", err)
+		return ExtractedFile{}, fmt.Errorf("resolve destination: %w", err)
+	}
+	target, rel, err := safeJoin(absDest, name)
+	if err != nil || rel == "." || strings.HasSuffix(name, "/") {
+		return ExtractedFile{}, fmt.Errorf("%w: %q", ErrInvalidPath, name)
+	}
+	if info, err := os.Lstat(target); err == nil && !info.Mode().IsRegular() {
+		return ExtractedFile{}, fmt.Errorf("%w: %s is not a regular file", ErrInvalidPath, rel)
+	}
+
+	e := &extraction{dest: absDest, budget: &budget{remaining: -1}, report: &ExtractReport{}}
+	if err := e.file(name, src); err != nil {
+		return ExtractedFile{}, err
+	}
+	return e.report.Files[0], nil
+}
+
+func extractZip(zipPath string, e *extraction) error {
+	r, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	defer r.Close()
+
+	// The central directory lists every entry up front.
+	if e.maxEntries > 0 && len(r.File) > e.maxEntries {
+		return fmt.Errorf("%w: %d entries, at most %d allowed", ErrLimitExceeded, len(r.File), e.maxEntries)
 	}
 
 	for _, f := range r.File {
-		if err := extractEntry(f, absDest); err != nil {
+		if err := extractZipEntry(f, e); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func extractEntry(f *zip.File, absDest string) error {
+func extractZipEntry(f *zip.File, e *extraction) error {
 	if f.Mode()&os.ModeSymlink != 0 {
 		return fmt.Errorf("%w: %s is a symlink", ErrUnsafeEntry, f.Name)
 	}
+	if f.FileInfo().IsDir() {
+		return e.dir(f.Name)
+	}
 
-	// Reject absolute paths and anything that, after cleaning, escapes destDir.
-	if filepath.IsAbs(f.Name) || strings.HasPrefix(f.Name, "/") {
-		return fmt.Errorf("%w: %s is absolute", ErrUnsafeEntry, f.Name)
+	src, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("%w: open entry %s: %v", ErrInvalidArchive, f.Name, err)
 	}
-	target := filepath.Join(absDest, f.Name)
-	if !strings.HasPrefix(target, absDest+string(os.PathSeparator)) && target != absDest {
-		return fmt.Errorf("%w: %s escapes destination", ErrUnsafeEntry, f.Name)
+	defer src.Close()
+	return e.file(f.Name, entryReader{src})
+}
+
+// entryReader reports errors reading an archive entry, such as a truncated
+// archive or a checksum mismatch, as ErrInvalidArchive.
+type entryReader struct {
+	r io.Reader
+}
+
+func (r entryReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) {
+		err = fmt.Errorf("%w: %v", ErrInvalidArchive, err)
 	}
+	return n, err
+}
 
-	if f.FileInfo().IsDir() {
-		return os.MkdirAll(target, 0o755)
+// extraction writes the entries of one archive under dest.
+type extraction struct {
+	dest       string // absolute
+	maxEntries int
+	entries    int
+	budget     *budget
+	report     *ExtractReport
+	paths      map[string]bool // extracted paths, true for directories
+}
+
+// count records an entry of an archive whose size is only known while
+// reading it.
+func (e *extraction) count() error {
+	e.entries++
+	if e.maxEntries > 0 && e.entries > e.maxEntries {
+		return fmt.Errorf("%w: more than %d entries", ErrLimitExceeded, e.maxEntries)
 	}
+	return nil
+}
 
-	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
-		return fmt.Errorf("mkdir parent of %s: %w", f.Name, err)
+func (e *extraction) dir(name string) error {
+	target, rel, err := safeJoin(e.dest, name)
+	if err != nil {
+		return err
 	}
+	if err := e.claim(rel, true); err != nil {
+		return err
+	}
+	return os.MkdirAll(target, 0o755)
+}
 
-	src, err := f.Open()
+func (e *extraction) file(name string, src io.Reader) error {
+	target, rel, err := safeJoin(e.dest, name)
 	if err != nil {
-		return fmt.Errorf("open entry %s: %w", f.Name, err)
+		return err
+	}
+	if rel == "." {
+		return fmt.Errorf("%w: %s is not a file", ErrUnsafeEntry, name)
+	}
+	if err := e.claim(rel, false); err != nil {
+		return err
 	}
-	defer src.Close()
 
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return fmt.Errorf("mkdir parent of %s: %w", name, err)
+	}
 	dst, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
 	if err != nil {
-		return fmt.Errorf("create %s: %w", f.Name, err)
+		return fmt.Errorf("create %s: %w", name, err)
 	}
 	defer dst.Close()
 
-	if _, err := io.Copy(dst, src); err != nil {
-		return fmt.Errorf("copy %s: %w", f.Name, err)
+	n, err := e.budget.copy(dst, src)
+	if err != nil {
+		return fmt.Errorf("extract %s: %w", name, err)
+	}
+
+	e.report.Files = append(e.report.Files, ExtractedFile{Path: rel, Bytes: n})
+	e.report.Bytes += n
+	return nil
+}
+
+// claim records rel, and its parent directories, as extracted. A file may
+// only be extracted once, and never where a directory is, or the other way
+// round: later entries would silently replace earlier ones.
+func (e *extraction) claim(rel string, isDir bool) error {
+	if e.paths == nil {
+		e.paths = make(map[string]bool)
 	}
+	for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+		if wasDir, ok := e.paths[dir]; ok && !wasDir {
+			return fmt.Errorf("%w: %s is inside file %s", ErrUnsafeEntry, rel, dir)
+		}
+		e.paths[dir] = true
+	}
+	if wasDir, ok := e.paths[rel]; ok && (!wasDir || !isDir) {
+		return fmt.Errorf("%w: %s appears more than once", ErrUnsafeEntry, rel)
+	}
+	e.paths[rel] = isDir
 	return nil
 }
+
+// stripSingleDir moves the contents of a lone top-level directory to the
+// root, as when a build output folder is archived as a whole.
+func (e *extraction) stripSingleDir() error {
+	entries, err := os.ReadDir(e.dest)
+	if err != nil {
+		return fmt.Errorf("read extracted dir: %w", err)
+	}
+	if len(entries) != 1 || !entries[0].IsDir() {
+		return nil
+	}
+	dir := entries[0].Name()
+
+	// Move the directory aside first, in case it holds an entry of the same
+	// name.
+	suffix, err := randomSuffix()
+	if err != nil {
+		return err
+	}
+	aside := filepath.Join(e.dest, ".strip-"+suffix)
+	if err := os.Rename(filepath.Join(e.dest, dir), aside); err != nil {
+		return fmt.Errorf("strip %s: %w", dir, err)
+	}
+	children, err := os.ReadDir(aside)
+	if err != nil {
+		return fmt.Errorf("strip %s: %w", dir, err)
+	}
+	for _, child := range children {
+		if err := os.Rename(filepath.Join(aside, child.Name()), filepath.Join(e.dest, child.Name())); err != nil {
+			return fmt.Errorf("strip %s: %w", dir, err)
+		}
+	}
+	if err := os.Remove(aside); err != nil {
+		return fmt.Errorf("strip %s: %w", dir, err)
+	}
+
+	e.report.StrippedDir = dir
+	for i, f := range e.report.Files {
+		e.report.Files[i].Path = strings.TrimPrefix(f.Path, dir+"/")
+	}
+	return nil
+}
+
+// safeJoin resolves name, a slash-separated entry path, under absDest. It
+// also returns the cleaned path relative to absDest ("." for absDest
+// itself).
+func safeJoin(absDest, name string) (string, string, error) {
+	// Reject absolute paths and anything that, after cleaning, escapes absDest.
+	if filepath.IsAbs(name) || strings.HasPrefix(name, "/") {
+		return "", "", fmt.Errorf("%w: %s is absolute", ErrUnsafeEntry, name)
+	}
+	target := filepath.Join(absDest, filepath.FromSlash(name))
+	if !strings.HasPrefix(target, absDest+string(os.PathSeparator)) && target != absDest {
+		return "", "", fmt.Errorf("%w: %s escapes destination", ErrUnsafeEntry, name)
+	}
+	rel, err := filepath.Rel(absDest, target)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %s: %v", ErrUnsafeEntry, name, err)
+	}
+	return target, filepath.ToSlash(rel), nil
+}
+
+// budget tracks how many more bytes an extraction may write.
+type budget struct {
+	remaining int64 // negative when unlimited
+}
+
+func newBudget(limits Limits, archiveSize int64) *budget {
+	remaining := int64(-1)
+	if limits.MaxExtractedBytes > 0 {
+		remaining = limits.MaxExtractedBytes
+	}
+	if limits.MaxCompressionRatio > 0 {
+		byRatio := max(archiveSize, 1) * limits.MaxCompressionRatio
+		if remaining < 0 || byRatio < remaining {
+			remaining = byRatio
+		}
+	}
+	return &budget{remaining: remaining}
+}
+
+// copy copies src to dst, failing with ErrLimitExceeded as soon as the
+// budget runs out.
+func (b *budget) copy(dst io.Writer, src io.Reader) (int64, error) {
+	if b.remaining < 0 {
+		return io.Copy(dst, src)
+	}
+
+	n, err := io.Copy(dst, io.LimitReader(src, b.remaining+1))
+	if err != nil {
+		return n, err
+	}
+	if n > b.remaining {
+		return n, fmt.Errorf("%w: extracted size or compression ratio too large", ErrLimitExceeded)
+	}
+	b.remaining -= n
+	return n, nil
+}
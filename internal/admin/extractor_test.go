@@ -0,0 +1,383 @@
+package admin
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testEntry is an entry of an archive built by a test.
+type testEntry struct {
+	name string
+	body string
+	dir  bool
+	link string // symlink target
+}
+
+func file(name, body string) testEntry { return testEntry{name: name, body: body} }
+func dir(name string) testEntry        { return testEntry{name: name, dir: true} }
+
+// buildZip writes entries to a zip archive in a temporary directory and
+// returns its path.
+func buildZip(t *testing.T, entries []testEntry) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate}
+		body := entry.body
+		switch {
+		case entry.dir:
+			header.Name = strings.TrimSuffix(entry.name, "/") + "/"
+			header.SetMode(fs.ModeDir | 0o755)
+		case entry.link != "":
+			header.SetMode(fs.ModeSymlink | 0o777)
+			body = entry.link
+		default:
+			header.SetMode(0o644)
+		}
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return writeArchive(t, "upload.zip", buf.Bytes())
+}
+
+func writeArchive(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// extractTo extracts archivePath into a fresh directory nested two levels
+// deep, so that entries escaping it can be detected, and returns that
+// directory.
+func extractTo(t *testing.T, archivePath string, format Format, limits Limits) (string, *ExtractReport, error) {
+	t.Helper()
+	dest := filepath.Join(t.TempDir(), "outer", "dest")
+	if err := os.MkdirAll(dest, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	report, err := Extract(archivePath, dest, format, limits)
+	return dest, report, err
+}
+
+// assertContained fails if anything was written next to dest.
+func assertContained(t *testing.T, dest string) {
+	t.Helper()
+	for _, root := range []string{filepath.Dir(dest), filepath.Dir(filepath.Dir(dest))} {
+		entries, err := os.ReadDir(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range entries {
+			if entry.Name() != "dest" && entry.Name() != "outer" {
+				t.Errorf("%s written outside the destination", filepath.Join(root, entry.Name()))
+			}
+		}
+	}
+}
+
+func reportPaths(report *ExtractReport) []string {
+	var paths []string
+	for _, f := range report.Files {
+		paths = append(paths, f.Path)
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+func TestExtractZip(t *testing.T) {
+	tests := []struct {
+		name     string
+		entries  []testEntry
+		limits   Limits
+		wantErr  error
+		wantDir  string   // StrippedDir
+		wantPath []string // reported files, sorted
+	}{
+		{
+			name:     "flat",
+			entries:  []testEntry{file("index.html", "<h1>hi</h1>"), dir("css"), file("css/app.css", "body{}")},
+			wantPath: []string{"css/app.css", "index.html"},
+		},
+		{
+			name:     "single top-level directory is stripped",
+			entries:  []testEntry{dir("dist"), file("dist/index.html", "hi"), file("dist/js/app.js", "1")},
+			wantDir:  "dist",
+			wantPath: []string{"index.html", "js/app.js"},
+		},
+		{
+			name:     "stripped directory holding an entry of its own name",
+			entries:  []testEntry{file("dist/index.html", "hi"), file("dist/dist/x.txt", "x")},
+			wantDir:  "dist",
+			wantPath: []string{"dist/x.txt", "index.html"},
+		},
+		{
+			name:     "leading dot slash",
+			entries:  []testEntry{dir("./"), file("./index.html", "hi")},
+			wantPath: []string{"index.html"},
+		},
+		{
+			name:     "repeated directory",
+			entries:  []testEntry{dir("a"), dir("a/"), file("a/b.txt", "b"), file("index.html", "hi")},
+			wantPath: []string{"a/b.txt", "index.html"},
+		},
+		{
+			name:    "two top-level directories are kept",
+			entries: []testEntry{file("a/index.html", "hi"), file("b/x.txt", "x")},
+			wantErr: ErrMissingIndex,
+		},
+		{
+			name:    "missing index.html",
+			entries: []testEntry{file("login.html", "hi")},
+			wantErr: ErrMissingIndex,
+		},
+		{
+			name:    "index.html is a directory",
+			entries: []testEntry{file("index.html/x.txt", "x"), file("other.txt", "o")},
+			wantErr: ErrMissingIndex,
+		},
+		{
+			name:    "empty archive",
+			wantErr: ErrMissingIndex,
+		},
+		{
+			name:    "parent directory",
+			entries: []testEntry{file("index.html", "hi"), file("../evil.txt", "x")},
+			wantErr: ErrUnsafeEntry,
+		},
+		{
+			name:    "parent directory after a subdirectory",
+			entries: []testEntry{file("index.html", "hi"), file("a/../../evil.txt", "x")},
+			wantErr: ErrUnsafeEntry,
+		},
+		{
+			name:    "parent directory entry",
+			entries: []testEntry{file("index.html", "hi"), dir("../../evil")},
+			wantErr: ErrUnsafeEntry,
+		},
+		{
+			name:    "absolute path",
+			entries: []testEntry{file("index.html", "hi"), file("/tmp/evil.txt", "x")},
+			wantErr: ErrUnsafeEntry,
+		},
+		{
+			name:    "symlink",
+			entries: []testEntry{file("index.html", "hi"), {name: "passwd", link: "/etc/passwd"}},
+			wantErr: ErrUnsafeEntry,
+		},
+		{
+			name:    "symlink to a sibling",
+			entries: []testEntry{{name: "index.html", link: "other.html"}, file("other.html", "hi")},
+			wantErr: ErrUnsafeEntry,
+		},
+		{
+			name:    "duplicate file",
+			entries: []testEntry{file("index.html", "good"), file("index.html", "evil")},
+			wantErr: ErrUnsafeEntry,
+		},
+		{
+			name:    "duplicate file after cleaning",
+			entries: []testEntry{file("index.html", "good"), file("a/../index.html", "evil")},
+			wantErr: ErrUnsafeEntry,
+		},
+		{
+			name:    "file then directory of the same name",
+			entries: []testEntry{file("index.html", "hi"), file("a", "a"), file("a/b.txt", "b")},
+			wantErr: ErrUnsafeEntry,
+		},
+		{
+			name:    "directory then file of the same name",
+			entries: []testEntry{file("index.html", "hi"), file("a/b.txt", "b"), file("a", "a")},
+			wantErr: ErrUnsafeEntry,
+		},
+		{
+			name:    "too many entries",
+			entries: []testEntry{file("index.html", "hi"), file("a.txt", "a"), file("b.txt", "b")},
+			limits:  Limits{MaxEntries: 2},
+			wantErr: ErrLimitExceeded,
+		},
+		{
+			name:     "entries at the limit",
+			entries:  []testEntry{file("index.html", "hi"), file("a.txt", "a")},
+			limits:   Limits{MaxEntries: 2},
+			wantPath: []string{"a.txt", "index.html"},
+		},
+		{
+			name:    "extracted size",
+			entries: []testEntry{file("index.html", "hi"), file("big.txt", strings.Repeat("x", 100))},
+			limits:  Limits{MaxExtractedBytes: 100},
+			wantErr: ErrLimitExceeded,
+		},
+		{
+			name:     "extracted size at the limit",
+			entries:  []testEntry{file("index.html", "hi"), file("big.txt", strings.Repeat("x", 98))},
+			limits:   Limits{MaxExtractedBytes: 100},
+			wantPath: []string{"big.txt", "index.html"},
+		},
+		{
+			name:    "compression ratio",
+			entries: []testEntry{file("index.html", "hi"), file("zeros.bin", strings.Repeat("\x00", 1<<20))},
+			limits:  Limits{MaxCompressionRatio: 10},
+			wantErr: ErrLimitExceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest, report, err := extractTo(t, buildZip(t, tt.entries), FormatZip, tt.limits)
+			assertContained(t, dest)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Extract() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+			if report.StrippedDir != tt.wantDir {
+				t.Errorf("StrippedDir = %q, want %q", report.StrippedDir, tt.wantDir)
+			}
+			if got := reportPaths(report); !slices.Equal(got, tt.wantPath) {
+				t.Errorf("files = %q, want %q", got, tt.wantPath)
+			}
+			for _, path := range tt.wantPath {
+				if _, err := os.Stat(filepath.Join(dest, filepath.FromSlash(path))); err != nil {
+					t.Errorf("reported file %s: %v", path, err)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractZipKeepsContent(t *testing.T) {
+	dest, report, err := extractTo(t, buildZip(t, []testEntry{
+		file("site/index.html", "<h1>hi</h1>"),
+		file("site/assets/app.js", "console.log(1)"),
+	}), FormatZip, Limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(dest, "assets", "app.js"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "console.log(1)" {
+		t.Errorf("assets/app.js = %q", got)
+	}
+	if report.Bytes != int64(len("<h1>hi</h1>")+len("console.log(1)")) {
+		t.Errorf("Bytes = %d", report.Bytes)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "site")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("stripped directory still exists: %v", err)
+	}
+}
+
+func TestExtractInvalidArchive(t *testing.T) {
+	path := writeArchive(t, "upload.zip", []byte("not a zip"))
+	if _, _, err := extractTo(t, path, FormatZip, Limits{}); !errors.Is(err, ErrInvalidArchive) {
+		t.Fatalf("Extract() error = %v, want %v", err, ErrInvalidArchive)
+	}
+}
+
+func TestSafeJoin(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "dest")
+	tests := []struct {
+		name    string
+		wantRel string
+		wantErr bool
+	}{
+		{name: "index.html", wantRel: "index.html"},
+		{name: "a/b/c.txt", wantRel: "a/b/c.txt"},
+		{name: "./a//b/", wantRel: "a/b"},
+		{name: "a/../b.txt", wantRel: "b.txt"},
+		{name: ".", wantRel: "."},
+		{name: "", wantRel: "."},
+		{name: "a/..", wantRel: "."},
+		{name: "..", wantErr: true},
+		{name: "../dest", wantRel: "."},
+		{name: "../dest2/x", wantErr: true},
+		{name: "a/../../x", wantErr: true},
+		{name: "/etc/passwd", wantErr: true},
+		{name: "/", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, rel, err := safeJoin(dest, tt.name)
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnsafeEntry) {
+					t.Fatalf("safeJoin(%q) error = %v, want %v", tt.name, err, ErrUnsafeEntry)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("safeJoin(%q) error = %v", tt.name, err)
+			}
+			if rel != tt.wantRel {
+				t.Errorf("rel = %q, want %q", rel, tt.wantRel)
+			}
+			if want := filepath.Join(dest, filepath.FromSlash(tt.wantRel)); target != want {
+				t.Errorf("target = %q, want %q", target, want)
+			}
+		})
+	}
+}
+
+func TestBudget(t *testing.T) {
+	tests := []struct {
+		name        string
+		limits      Limits
+		archiveSize int64
+		want        int64
+	}{
+		{name: "unlimited", want: -1},
+		{name: "extracted bytes", limits: Limits{MaxExtractedBytes: 1000}, archiveSize: 10, want: 1000},
+		{name: "ratio", limits: Limits{MaxCompressionRatio: 10}, archiveSize: 10, want: 100},
+		{name: "ratio below extracted bytes", limits: Limits{MaxExtractedBytes: 1000, MaxCompressionRatio: 10}, archiveSize: 10, want: 100},
+		{name: "extracted bytes below ratio", limits: Limits{MaxExtractedBytes: 50, MaxCompressionRatio: 10}, archiveSize: 10, want: 50},
+		{name: "empty archive", limits: Limits{MaxCompressionRatio: 10}, want: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newBudget(tt.limits, tt.archiveSize).remaining; got != tt.want {
+				t.Errorf("remaining = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBudgetCopy(t *testing.T) {
+	b := &budget{remaining: 10}
+	var dst bytes.Buffer
+	if n, err := b.copy(&dst, strings.NewReader("123456")); err != nil || n != 6 {
+		t.Fatalf("copy() = %d, %v", n, err)
+	}
+	if n, err := b.copy(&dst, strings.NewReader("1234")); err != nil || n != 4 {
+		t.Fatalf("copy() = %d, %v", n, err)
+	}
+	if _, err := b.copy(&dst, strings.NewReader("1")); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("copy() past the budget error = %v, want %v", err, ErrLimitExceeded)
+	}
+	// The reader is not drained past the budget.
+	if dst.Len() > 11 {
+		t.Errorf("wrote %d bytes", dst.Len())
+	}
+}
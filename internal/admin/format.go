@@ -0,0 +1,53 @@
+package admin
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+)
+
+// Format is an archive format accepted for login asset uploads.
+type Format string
+
+const (
+	FormatZip     Format = "zip"
+	FormatTar     Format = "tar"
+	FormatTarGzip Format = "tar.gz"
+	FormatTarZstd Format = "tar.zst"
+)
+
+// contentTypes maps archive media types to formats. Compressed types are
+// assumed to wrap a tar.
+var contentTypes = map[string]Format{
+	"application/zip":              FormatZip,
+	"application/x-zip-compressed": FormatZip,
+	"application/x-tar":            FormatTar,
+	"application/gzip":             FormatTarGzip,
+	"application/x-gzip":           FormatTarGzip,
+	"application/x-gtar":           FormatTarGzip,
+	"application/x-compressed-tar": FormatTarGzip,
+	"application/zstd":             FormatTarZstd,
+}
+
+// DetectFormat determines the format of an upload from its Content-Type or,
+// when that names no archive format (e.g. application/octet-stream), from the
+// magic bytes at the start of head.
+func DetectFormat(contentType string, head []byte) (Format, error) {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		if format, ok := contentTypes[mediaType]; ok {
+			return format, nil
+		}
+	}
+
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return FormatZip, nil
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return FormatTarGzip, nil
+	case bytes.HasPrefix(head, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return FormatTarZstd, nil
+	case len(head) >= 262 && bytes.Equal(head[257:262], []byte("ustar")):
+		return FormatTar, nil
+	}
+	return "", fmt.Errorf("%w: unrecognized format", ErrInvalidArchive)
+}
@@ -0,0 +1,137 @@
+package admin
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/iamolegga/lana/internal/config"
+	"go.yaml.in/yaml/v3"
+)
+
+const (
+	hostFileSuffix = ".yaml"
+	keyFileSuffix  = ".key.pem"
+)
+
+// HostStore persists hosts created through the admin API as one YAML file
+// per host, with the host's generated JWT signing key next to it:
+//
+//	/var/lana/hosts/auth.team-a.example.com.yaml
+//	/var/lana/hosts/auth.team-a.example.com.key.pem
+//
+// Host names must be validated with config.ValidateHostName before use.
+type HostStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func NewHostStore(dir string) *HostStore {
+	return &HostStore{dir: dir}
+}
+
+// Load returns the stored hosts.
+func (s *HostStore) Load() (map[string]config.HostConfig, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("read host store: %w", err)
+	}
+
+	hosts := make(map[string]config.HostConfig)
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), hostFileSuffix)
+		if !ok || entry.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("read stored host %s: %w", name, err)
+		}
+		var host config.HostConfig
+		if err := yaml.Unmarshal(data, &host); err != nil {
+			return nil, fmt.Errorf("parse stored host %s: %w", name, err)
+		}
+		hosts[name] = host
+	}
+	return hosts, nil
+}
+
+// Save stores host, replacing any previous version atomically.
+func (s *HostStore) Save(name string, host config.HostConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := yaml.Marshal(host)
+	if err != nil {
+		return fmt.Errorf("encode host %s: %w", name, err)
+	}
+	return writeFileAtomic(filepath.Join(s.dir, name+hostFileSuffix), data, 0o600)
+}
+
+// Delete removes host and its signing key.
+func (s *HostStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, suffix := range []string{hostFileSuffix, keyFileSuffix} {
+		if err := os.Remove(filepath.Join(s.dir, name+suffix)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("delete host %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// SigningKey returns the path of the host's JWT signing key, generating an
+// RSA key on first use, and whether it was generated. Replacing a host keeps
+// its key.
+func (s *HostStore) SigningKey(name string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := filepath.Join(s.dir, name+keyFileSuffix)
+	if _, err := os.Stat(path); err == nil {
+		return path, false, nil
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", false, fmt.Errorf("generate signing key: %w", err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+	if err := writeFileAtomic(path, data, 0o600); err != nil {
+		return "", false, err
+	}
+	return path, true, nil
+}
+
+// writeFileAtomic writes data to a temporary file and renames it over path,
+// so readers never see a partial file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	suffix, err := randomSuffix()
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(path), ".tmp-"+suffix)
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return fmt.Errorf("write %s: %w", filepath.Base(path), err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("write %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
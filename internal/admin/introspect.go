@@ -0,0 +1,41 @@
+package admin
+
+// HostInfo describes a host being served, for introspection.
+type HostInfo struct {
+	Name string `json:"name"`
+	// Source is "config" for hosts from the config file and "api" for hosts
+	// created through the admin API.
+	Source              string   `json:"source"`
+	Providers           []string `json:"providers"`
+	AllowedRedirectURLs []string `json:"allowed_redirect_urls"`
+	LoginDir            string   `json:"login_dir,omitempty"`
+	Template            bool     `json:"template"`
+	JWT                 JWTInfo  `json:"jwt"`
+	// Assets is only filled in for a single host.
+	Assets *AssetsInfo `json:"assets,omitempty"`
+}
+
+// JWTInfo describes the tokens issued for a host.
+type JWTInfo struct {
+	Audience  string `json:"audience"`
+	Expiry    string `json:"expiry"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	// KeyFingerprint is the hex SHA-256 of the DER-encoded public key, as
+	// printed by `openssl pkey -pubout -outform DER | sha256sum`.
+	KeyFingerprint string `json:"key_fingerprint"`
+}
+
+// AssetsInfo describes the login assets being served for a host.
+type AssetsInfo struct {
+	// ActiveVersion is nil when the login directory is not versioned.
+	ActiveVersion *Version       `json:"active_version"`
+	Files         []FileChecksum `json:"files"`
+}
+
+// FileChecksum is a served file and its content hash.
+type FileChecksum struct {
+	Path   string `json:"path"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+}
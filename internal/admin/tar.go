@@ -0,0 +1,76 @@
+package admin
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// zstdMaxMemory caps the memory the zstd decoder may allocate, since the
+// window size is chosen by whoever built the archive.
+const zstdMaxMemory = 64 << 20
+
+func extractTar(archivePath string, format Format, e *extraction) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("open archive: %w", err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	switch format {
+	case FormatTarGzip:
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		defer gz.Close()
+		r = gz
+	case FormatTarZstd:
+		zr, err := zstd.NewReader(f,
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxMemory(zstdMaxMemory),
+		)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue // pax metadata, not an entry
+		}
+		if err := e.count(); err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = e.dir(hdr.Name)
+		case tar.TypeReg:
+			err = e.file(hdr.Name, entryReader{tr})
+		case tar.TypeSymlink, tar.TypeLink:
+			err = fmt.Errorf("%w: %s is a link", ErrUnsafeEntry, hdr.Name)
+		default:
+			err = fmt.Errorf("%w: %s is not a regular file or directory", ErrUnsafeEntry, hdr.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
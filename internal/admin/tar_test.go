@@ -0,0 +1,350 @@
+package admin
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// tarEntry is an entry of a tar archive built by a test.
+type tarEntry struct {
+	typeflag byte
+	name     string
+	body     string
+	linkname string
+}
+
+func tarFile(name, body string) tarEntry {
+	return tarEntry{typeflag: tar.TypeReg, name: name, body: body}
+}
+func tarDir(name string) tarEntry { return tarEntry{typeflag: tar.TypeDir, name: name + "/"} }
+
+// buildTar writes entries to an archive in format in a temporary directory
+// and returns its path.
+func buildTar(t *testing.T, format Format, entries []tarEntry) string {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch format {
+	case FormatTar:
+		w = nopWriteCloser{&buf}
+	case FormatTarGzip:
+		w = gzip.NewWriter(&buf)
+	case FormatTarZstd:
+		zw, err := zstd.NewWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w = zw
+	default:
+		t.Fatalf("unsupported format %q", format)
+	}
+
+	tw := tar.NewWriter(w)
+	for _, entry := range entries {
+		hdr := &tar.Header{
+			Typeflag: entry.typeflag,
+			Name:     entry.name,
+			Linkname: entry.linkname,
+			Mode:     0o644,
+			Size:     int64(len(entry.body)),
+		}
+		if entry.typeflag != tar.TypeReg {
+			hdr.Size = 0
+		}
+		if entry.typeflag == tar.TypeXGlobalHeader {
+			hdr = &tar.Header{
+				Typeflag:   tar.TypeXGlobalHeader,
+				PAXRecords: map[string]string{"comment": "global"},
+			}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Size > 0 {
+			if _, err := tw.Write([]byte(entry.body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return writeArchive(t, "upload."+string(format), buf.Bytes())
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+var tarFormats = []Format{FormatTar, FormatTarGzip, FormatTarZstd}
+
+func TestExtractTar(t *testing.T) {
+	tests := []struct {
+		name     string
+		entries  []tarEntry
+		limits   Limits
+		wantErr  error
+		wantDir  string   // StrippedDir
+		wantPath []string // reported files, sorted
+	}{
+		{
+			name:     "flat",
+			entries:  []tarEntry{tarFile("index.html", "hi"), tarDir("css"), tarFile("css/app.css", "body{}")},
+			wantPath: []string{"css/app.css", "index.html"},
+		},
+		{
+			name:     "single top-level directory is stripped",
+			entries:  []tarEntry{tarDir("dist"), tarFile("dist/index.html", "hi"), tarFile("dist/js/app.js", "1")},
+			wantDir:  "dist",
+			wantPath: []string{"index.html", "js/app.js"},
+		},
+		{
+			name:     "tar of the current directory",
+			entries:  []tarEntry{tarDir("."), tarFile("./index.html", "hi")},
+			wantPath: []string{"index.html"},
+		},
+		{
+			name:     "global pax header",
+			entries:  []tarEntry{{typeflag: tar.TypeXGlobalHeader, name: "pax_global_header"}, tarFile("index.html", "hi")},
+			limits:   Limits{MaxEntries: 1},
+			wantPath: []string{"index.html"},
+		},
+		{
+			name:    "missing index.html",
+			entries: []tarEntry{tarFile("a/index.html", "hi"), tarFile("b.txt", "b")},
+			wantErr: ErrMissingIndex,
+		},
+		{
+			name:    "parent directory",
+			entries: []tarEntry{tarFile("index.html", "hi"), tarFile("../evil.txt", "x")},
+			wantErr: ErrUnsafeEntry,
+		},
+		{
+			name:    "parent directory entry",
+			entries: []tarEntry{tarFile("index.html", "hi"), tarDir("a/../../evil")},
+			wantErr: ErrUnsafeEntry,
+		},
+		{
+			name:    "absolute path",
+			entries: []tarEntry{tarFile("index.html", "hi"), tarFile("/tmp/evil.txt", "x")},
+			wantErr: ErrUnsafeEntry,
+		},
+		{
+			name:    "symlink",
+			entries: []tarEntry{tarFile("index.html", "hi"), {typeflag: tar.TypeSymlink, name: "passwd", linkname: "/etc/passwd"}},
+			wantErr: ErrUnsafeEntry,
+		},
+		{
+			name: "symlink followed by a file through it",
+			entries: []tarEntry{
+				tarFile("index.html", "hi"),
+				{typeflag: tar.TypeSymlink, name: "out", linkname: "../.."},
+				tarFile("out/evil.txt", "x"),
+			},
+			wantErr: ErrUnsafeEntry,
+		},
+		{
+			name:    "hard link",
+			entries: []tarEntry{tarFile("index.html", "hi"), {typeflag: tar.TypeLink, name: "passwd", linkname: "/etc/passwd"}},
+			wantErr: ErrUnsafeEntry,
+		},
+		{
+			name:    "character device",
+			entries: []tarEntry{tarFile("index.html", "hi"), {typeflag: tar.TypeChar, name: "null"}},
+			wantErr: ErrUnsafeEntry,
+		},
+		{
+			name:    "fifo",
+			entries: []tarEntry{tarFile("index.html", "hi"), {typeflag: tar.TypeFifo, name: "pipe"}},
+			wantErr: ErrUnsafeEntry,
+		},
+		{
+			name:    "duplicate file",
+			entries: []tarEntry{tarFile("index.html", "good"), tarFile("./index.html", "evil")},
+			wantErr: ErrUnsafeEntry,
+		},
+		{
+			name:    "file then directory of the same name",
+			entries: []tarEntry{tarFile("index.html", "hi"), tarFile("a", "a"), tarDir("a")},
+			wantErr: ErrUnsafeEntry,
+		},
+		{
+			name:    "too many entries, directories included",
+			entries: []tarEntry{tarDir("a"), tarDir("b"), tarFile("index.html", "hi")},
+			limits:  Limits{MaxEntries: 2},
+			wantErr: ErrLimitExceeded,
+		},
+		{
+			name:    "extracted size",
+			entries: []tarEntry{tarFile("index.html", "hi"), tarFile("big.txt", strings.Repeat("x", 100))},
+			limits:  Limits{MaxExtractedBytes: 100},
+			wantErr: ErrLimitExceeded,
+		},
+	}
+
+	for _, format := range tarFormats {
+		for _, tt := range tests {
+			t.Run(string(format)+"/"+tt.name, func(t *testing.T) {
+				dest, report, err := extractTo(t, buildTar(t, format, tt.entries), format, tt.limits)
+				assertContained(t, dest)
+				if tt.wantErr != nil {
+					if !errors.Is(err, tt.wantErr) {
+						t.Fatalf("Extract() error = %v, want %v", err, tt.wantErr)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Extract() error = %v", err)
+				}
+				if report.StrippedDir != tt.wantDir {
+					t.Errorf("StrippedDir = %q, want %q", report.StrippedDir, tt.wantDir)
+				}
+				if got := reportPaths(report); !slices.Equal(got, tt.wantPath) {
+					t.Errorf("files = %q, want %q", got, tt.wantPath)
+				}
+			})
+		}
+	}
+}
+
+func TestExtractTarCompressionRatio(t *testing.T) {
+	entries := []tarEntry{tarFile("index.html", "hi"), tarFile("zeros.bin", strings.Repeat("\x00", 1<<20))}
+	for _, format := range []Format{FormatTarGzip, FormatTarZstd} {
+		t.Run(string(format), func(t *testing.T) {
+			_, _, err := extractTo(t, buildTar(t, format, entries), format, Limits{MaxCompressionRatio: 10})
+			if !errors.Is(err, ErrLimitExceeded) {
+				t.Fatalf("Extract() error = %v, want %v", err, ErrLimitExceeded)
+			}
+		})
+	}
+}
+
+func TestExtractTarInvalid(t *testing.T) {
+	entries := []tarEntry{tarFile("index.html", strings.Repeat("x", 2048))}
+	valid, err := os.ReadFile(buildTar(t, FormatTar, entries))
+	if err != nil {
+		t.Fatal(err)
+	}
+	validGzip, err := os.ReadFile(buildTar(t, FormatTarGzip, entries))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		format Format
+		data   []byte
+	}{
+		{name: "not gzip", format: FormatTarGzip, data: []byte("not gzip")},
+		{name: "not zstd", format: FormatTarZstd, data: []byte("not zstd")},
+		{name: "truncated tar", format: FormatTar, data: valid[:1024]},
+		{name: "truncated tar.gz", format: FormatTarGzip, data: validGzip[:len(validGzip)/2]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeArchive(t, "upload", tt.data)
+			if _, _, err := extractTo(t, path, tt.format, Limits{}); !errors.Is(err, ErrInvalidArchive) {
+				t.Fatalf("Extract() error = %v, want %v", err, ErrInvalidArchive)
+			}
+		})
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tarHead, err := os.ReadFile(buildTar(t, FormatTar, []tarEntry{tarFile("index.html", "hi")}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		contentType string
+		head        []byte
+		want        Format
+		wantErr     bool
+	}{
+		{name: "zip type", contentType: "application/zip", want: FormatZip},
+		{name: "gzip type with parameters", contentType: "application/gzip; charset=binary", want: FormatTarGzip},
+		{name: "zstd type", contentType: "application/zstd", want: FormatTarZstd},
+		{name: "zip magic", contentType: "application/octet-stream", head: []byte("PK\x03\x04rest"), want: FormatZip},
+		{name: "gzip magic", head: []byte{0x1f, 0x8b, 0x08}, want: FormatTarGzip},
+		{name: "zstd magic", head: []byte{0x28, 0xb5, 0x2f, 0xfd}, want: FormatTarZstd},
+		{name: "tar magic", head: tarHead[:512], want: FormatTar},
+		{name: "unknown", contentType: "text/plain", head: []byte("hello"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DetectFormat(tt.contentType, tt.head)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidArchive) {
+					t.Fatalf("DetectFormat() error = %v, want %v", err, ErrInvalidArchive)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("DetectFormat() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		wantRel string
+		wantErr bool
+	}{
+		{name: "top level", path: "index.html", wantRel: "index.html"},
+		{name: "new directory", path: "assets/js/app.js", wantRel: "assets/js/app.js"},
+		{name: "replaces a file", path: "css/app.css", wantRel: "css/app.css"},
+		{name: "cleaned", path: "./assets/../logo.svg", wantRel: "logo.svg"},
+		{name: "empty", path: "", wantErr: true},
+		{name: "root", path: ".", wantErr: true},
+		{name: "trailing slash", path: "assets/", wantErr: true},
+		{name: "parent directory", path: "../evil.txt", wantErr: true},
+		{name: "absolute", path: "/tmp/evil.txt", wantErr: true},
+		{name: "existing directory", path: "css", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := filepath.Join(t.TempDir(), "outer", "dest")
+			if err := os.MkdirAll(filepath.Join(dest, "css"), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dest, "css", "app.css"), []byte("old"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := WriteFile(dest, tt.path, strings.NewReader("new"))
+			assertContained(t, dest)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidPath) {
+					t.Fatalf("WriteFile(%q) error = %v, want %v", tt.path, err, ErrInvalidPath)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("WriteFile(%q) error = %v", tt.path, err)
+			}
+			if got.Path != tt.wantRel || got.Bytes != 3 {
+				t.Errorf("WriteFile(%q) = %+v, want path %q and 3 bytes", tt.path, got, tt.wantRel)
+			}
+			body, err := os.ReadFile(filepath.Join(dest, filepath.FromSlash(tt.wantRel)))
+			if err != nil || string(body) != "new" {
+				t.Errorf("%s = %q, %v", tt.wantRel, body, err)
+			}
+		})
+	}
+}
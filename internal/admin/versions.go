@@ -0,0 +1,527 @@
+package admin
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrVersionNotFound is returned for a version that does not exist.
+	ErrVersionNotFound = errors.New("version not found")
+	// ErrActiveVersion is returned when deleting the active version.
+	ErrActiveVersion = errors.New("version is active")
+	// ErrVersionChanged is returned by AddIfActive when another version was
+	// activated since the staging copy was made.
+	ErrVersionChanged = errors.New("active version changed, retry")
+)
+
+// staleStagingAge is how old a staging directory or symlink has to be before
+// it is taken for the leftover of an upload interrupted by a crash. Younger
+// ones may belong to an upload in flight on another replica sharing the
+// volume.
+const staleStagingAge = time.Hour
+
+// Version is one uploaded set of login assets.
+type Version struct {
+	ID        int       `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Bytes     int64     `json:"bytes"`
+	Active    bool      `json:"active"`
+}
+
+// UploadResponse is returned by the login asset upload endpoint.
+type UploadResponse struct {
+	Status  string         `json:"status"`
+	Version Version        `json:"version"`
+	Report  *ExtractReport `json:"report"`
+}
+
+// Versions keeps numbered versions of a host's login assets next to its
+// login directory, which becomes a symlink to the active one:
+//
+//	/srv/login/auth-example-com -> .auth-example-com.versions/3
+//	/srv/login/.auth-example-com.versions/{1,2,3}
+//
+// Switching versions replaces the symlink with rename(2), so the login
+// directory never disappears and readers see either the old or the new
+// version.
+type Versions struct {
+	loginDir string
+	root     string // directory holding the versions
+	keep     int
+	mu       sync.Mutex
+}
+
+// NewVersions manages the versions of loginDir, keeping the newest keep
+// versions (the active one is never pruned). Staging directories left
+// behind by a crash are removed.
+func NewVersions(loginDir string, keep int) *Versions {
+	// filepath.Clean strips any trailing slash so filepath.Dir returns the
+	// true parent, not the directory itself.
+	loginDir = filepath.Clean(loginDir)
+	v := &Versions{
+		loginDir: loginDir,
+		root:     filepath.Join(filepath.Dir(loginDir), "."+filepath.Base(loginDir)+".versions"),
+		keep:     keep,
+	}
+	v.removeStaleStaging()
+	return v
+}
+
+// StagingDir creates an empty directory on the same filesystem as the
+// versions, to extract an upload into before passing it to Add. The caller
+// removes it when the upload fails.
+func (v *Versions) StagingDir() (string, error) {
+	v.removeStaleStaging()
+	if err := os.MkdirAll(v.root, 0o755); err != nil {
+		return "", fmt.Errorf("create versions dir: %w", err)
+	}
+	suffix, err := randomSuffix()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(v.root, ".tmp-"+suffix)
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		return "", fmt.Errorf("create staging dir: %w", err)
+	}
+	return dir, nil
+}
+
+// StagingCopy is like StagingDir, but the directory starts out as a copy of
+// what is being served, to change individual files before passing it to
+// AddIfActive with the returned base version. Symlinks to files are copied
+// as regular files; other special files are skipped.
+func (v *Versions) StagingCopy() (dir string, base int, err error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	dir, err = v.StagingDir()
+	if err != nil {
+		return "", 0, err
+	}
+	base = v.active()
+
+	src, err := filepath.EvalSymlinks(v.loginDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return dir, base, nil
+	}
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return "", 0, fmt.Errorf("resolve login dir: %w", err)
+	}
+	if err := copyTree(src, dir); err != nil {
+		_ = os.RemoveAll(dir)
+		return "", 0, fmt.Errorf("copy active version: %w", err)
+	}
+	return dir, base, nil
+}
+
+// Add turns dir (from StagingDir) into the next version, activates it and
+// prunes old versions.
+func (v *Versions) Add(dir string) (Version, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.add(dir)
+}
+
+// AddIfActive is Add for a directory from StagingCopy. It fails with
+// ErrVersionChanged if a version other than base was activated in the
+// meantime, which the new version would silently undo.
+func (v *Versions) AddIfActive(dir string, base int) (Version, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.active() != base {
+		return Version{}, ErrVersionChanged
+	}
+	return v.add(dir)
+}
+
+func (v *Versions) add(dir string) (Version, error) {
+	if err := v.adoptLegacyDir(); err != nil {
+		return Version{}, err
+	}
+
+	ids, err := v.ids()
+	if err != nil {
+		return Version{}, err
+	}
+	id := 1
+	if len(ids) > 0 {
+		id = ids[len(ids)-1] + 1
+	}
+
+	if err := os.Rename(dir, v.path(id)); err != nil {
+		return Version{}, fmt.Errorf("store version %d: %w", id, err)
+	}
+	if err := v.activate(id); err != nil {
+		return Version{}, err
+	}
+	v.prune(append(ids, id), id)
+
+	return v.version(id, id)
+}
+
+// List returns the versions, oldest first.
+func (v *Versions) List() ([]Version, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	ids, err := v.ids()
+	if err != nil {
+		return nil, err
+	}
+	active := v.active()
+
+	versions := make([]Version, 0, len(ids))
+	for _, id := range ids {
+		version, err := v.version(id, active)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
+
+// Active returns the version being served, or nil when the login directory
+// is not a version.
+func (v *Versions) Active() (*Version, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	id := v.active()
+	if id == 0 {
+		return nil, nil
+	}
+	version, err := v.version(id, id)
+	if err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// Checksums returns the files being served with their SHA-256, sorted by
+// path.
+func (v *Versions) Checksums() ([]FileChecksum, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	files := []FileChecksum{}
+	root, err := filepath.EvalSymlinks(v.loginDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return files, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("resolve login dir: %w", err)
+	}
+
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		sum, size, err := fileSHA256(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, FileChecksum{Path: filepath.ToSlash(rel), Bytes: size, SHA256: sum})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("checksum login assets: %w", err)
+	}
+	return files, nil
+}
+
+// Activate makes version id the one being served.
+func (v *Versions) Activate(id int) (Version, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if _, err := os.Stat(v.path(id)); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return Version{}, ErrVersionNotFound
+		}
+		return Version{}, err
+	}
+	if err := v.activate(id); err != nil {
+		return Version{}, err
+	}
+	return v.version(id, id)
+}
+
+// Delete removes version id, which must not be active.
+func (v *Versions) Delete(id int) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if _, err := os.Stat(v.path(id)); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ErrVersionNotFound
+		}
+		return err
+	}
+	if v.active() == id {
+		return ErrActiveVersion
+	}
+	return os.RemoveAll(v.path(id))
+}
+
+// activate points the login directory at version id.
+func (v *Versions) activate(id int) error {
+	suffix, err := randomSuffix()
+	if err != nil {
+		return err
+	}
+	link := filepath.Join(filepath.Dir(v.loginDir), ".tmp-link-"+suffix)
+	target, err := filepath.Rel(filepath.Dir(v.loginDir), v.path(id))
+	if err != nil {
+		return fmt.Errorf("resolve version path: %w", err)
+	}
+
+	if err := os.Symlink(target, link); err != nil {
+		return fmt.Errorf("create symlink: %w", err)
+	}
+	if err := os.Rename(link, v.loginDir); err != nil {
+		_ = os.Remove(link)
+		return fmt.Errorf("switch to version %d: %w", id, err)
+	}
+	return nil
+}
+
+// adoptLegacyDir moves a non-empty login directory that predates versioning
+// into the versions, so that it can be rolled back to, and serves it from
+// there straight away. A directory cannot be replaced by a symlink
+// atomically, so the login directory is missing between the two renames; if
+// the symlink cannot be created, the directory is moved back.
+func (v *Versions) adoptLegacyDir() error {
+	info, err := os.Lstat(v.loginDir)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && info.Mode()&os.ModeSymlink != 0) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is neither a directory nor a symlink", v.loginDir)
+	}
+
+	// An empty directory (e.g. pre-created by a deployment) has nothing to
+	// roll back to.
+	if entries, err := os.ReadDir(v.loginDir); err == nil && len(entries) == 0 {
+		return os.Remove(v.loginDir)
+	}
+
+	if err := os.MkdirAll(v.root, 0o755); err != nil {
+		return fmt.Errorf("create versions dir: %w", err)
+	}
+	ids, err := v.ids()
+	if err != nil {
+		return err
+	}
+	id := 1
+	if len(ids) > 0 {
+		id = ids[len(ids)-1] + 1
+	}
+	if err := os.Rename(v.loginDir, v.path(id)); err != nil {
+		return fmt.Errorf("adopt existing login dir: %w", err)
+	}
+	if err := v.activate(id); err != nil {
+		if restoreErr := os.Rename(v.path(id), v.loginDir); restoreErr != nil {
+			return fmt.Errorf("adopt existing login dir: %w (restoring it: %v)", err, restoreErr)
+		}
+		return fmt.Errorf("adopt existing login dir: %w", err)
+	}
+	return nil
+}
+
+// removeStaleStaging removes staging directories and symlinks older than
+// staleStagingAge. Errors are swallowed; the next call tries again.
+func (v *Versions) removeStaleStaging() {
+	removeStale(v.root, ".tmp-")
+	removeStale(filepath.Dir(v.loginDir), ".tmp-link-")
+}
+
+// removeStale removes the entries of dir whose name starts with prefix and
+// that were last modified more than staleStagingAge ago.
+func removeStale(dir, prefix string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), prefix) {
+			continue
+		}
+		info, err := entry.Info() // does not follow symlinks
+		if err != nil || time.Since(info.ModTime()) < staleStagingAge {
+			continue
+		}
+		_ = os.RemoveAll(filepath.Join(dir, entry.Name()))
+	}
+}
+
+// prune removes the oldest versions beyond keep, sparing active.
+func (v *Versions) prune(ids []int, active int) {
+	for len(ids) > v.keep {
+		if ids[0] != active {
+			_ = os.RemoveAll(v.path(ids[0]))
+		}
+		ids = ids[1:]
+	}
+}
+
+// ids returns the existing version numbers in ascending order.
+func (v *Versions) ids() ([]int, error) {
+	entries, err := os.ReadDir(v.root)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read versions dir: %w", err)
+	}
+
+	var ids []int
+	for _, entry := range entries {
+		id, err := strconv.Atoi(entry.Name())
+		if err != nil || id <= 0 || !entry.IsDir() {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// active returns the number of the version the login directory points to,
+// or 0 when it points to none.
+func (v *Versions) active() int {
+	target, err := os.Readlink(v.loginDir)
+	if err != nil {
+		return 0
+	}
+	if filepath.Dir(filepath.Join(filepath.Dir(v.loginDir), target)) != v.root {
+		return 0
+	}
+	id, err := strconv.Atoi(filepath.Base(target))
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+func (v *Versions) version(id, active int) (Version, error) {
+	info, err := os.Stat(v.path(id))
+	if err != nil {
+		return Version{}, err
+	}
+	return Version{
+		ID:        id,
+		CreatedAt: info.ModTime().UTC(),
+		Bytes:     treeSize(v.path(id)),
+		Active:    id == active,
+	}, nil
+}
+
+func (v *Versions) path(id int) string {
+	return filepath.Join(v.root, strconv.Itoa(id))
+}
+
+func randomSuffix() (string, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// copyTree copies the directories and files under src into dst, which must
+// exist.
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := os.Stat(path) // follows symlinks
+		switch {
+		case err != nil:
+			return nil // dangling symlink
+		case d.IsDir():
+			return os.MkdirAll(target, 0o755)
+		case !info.Mode().IsRegular():
+			return nil
+		}
+		return copyFile(path, target)
+	})
+}
+
+func fileSHA256(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// treeSize returns the total size of the files under root. Errors are
+// swallowed — this is informational only.
+func treeSize(root string) int64 {
+	var total int64
+	_ = filepath.WalkDir(root, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total
+}
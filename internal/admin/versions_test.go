@@ -0,0 +1,322 @@
+package admin
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// newTestVersions returns versions of a login dir that does not exist yet.
+func newTestVersions(t *testing.T, keep int) *Versions {
+	t.Helper()
+	return NewVersions(filepath.Join(t.TempDir(), "login"), keep)
+}
+
+// addVersion stages a version whose index.html holds body and adds it.
+func addVersion(t *testing.T, v *Versions, body string) Version {
+	t.Helper()
+	dir, err := v.StagingDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	version, err := v.Add(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return version
+}
+
+// assertServing fails unless the login dir serves an index.html holding body
+// from version id.
+func assertServing(t *testing.T, v *Versions, id int, body string) {
+	t.Helper()
+	got, err := os.ReadFile(filepath.Join(v.loginDir, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != body {
+		t.Errorf("serving %q, want %q", got, body)
+	}
+	active, err := v.Active()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active == nil || active.ID != id || !active.Active {
+		t.Errorf("active version = %+v, want %d", active, id)
+	}
+}
+
+func listIDs(t *testing.T, v *Versions) []int {
+	t.Helper()
+	versions, err := v.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for _, version := range versions {
+		ids = append(ids, version.ID)
+	}
+	return ids
+}
+
+func TestVersionsAddAndActivate(t *testing.T) {
+	v := newTestVersions(t, 5)
+
+	if active, err := v.Active(); err != nil || active != nil {
+		t.Fatalf("Active before any upload = %+v, %v", active, err)
+	}
+
+	if got := addVersion(t, v, "one"); got.ID != 1 || !got.Active || got.Bytes != 3 {
+		t.Errorf("first version = %+v", got)
+	}
+	assertServing(t, v, 1, "one")
+
+	info, err := os.Lstat(v.loginDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Fatal("login dir is not a symlink")
+	}
+	target, err := os.Readlink(v.loginDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.IsAbs(target) {
+		t.Errorf("symlink target %q is absolute, so the volume cannot be mounted elsewhere", target)
+	}
+
+	addVersion(t, v, "two")
+	assertServing(t, v, 2, "two")
+
+	// Roll back, then forward again.
+	if got, err := v.Activate(1); err != nil || got.ID != 1 || !got.Active {
+		t.Fatalf("Activate(1) = %+v, %v", got, err)
+	}
+	assertServing(t, v, 1, "one")
+	if _, err := v.Activate(2); err != nil {
+		t.Fatal(err)
+	}
+	assertServing(t, v, 2, "two")
+
+	versions, err := v.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || versions[0].Active || !versions[1].Active {
+		t.Errorf("List = %+v", versions)
+	}
+
+	// No temporary symlinks are left next to the login dir.
+	entries, err := os.ReadDir(filepath.Dir(v.loginDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Name() != "login" && entry.Name() != ".login.versions" {
+			t.Errorf("unexpected %s next to the login dir", entry.Name())
+		}
+	}
+}
+
+func TestVersionsErrors(t *testing.T) {
+	v := newTestVersions(t, 5)
+	addVersion(t, v, "one")
+	addVersion(t, v, "two")
+
+	if _, err := v.Activate(7); !errors.Is(err, ErrVersionNotFound) {
+		t.Errorf("Activate(7) = %v, want ErrVersionNotFound", err)
+	}
+	if err := v.Delete(7); !errors.Is(err, ErrVersionNotFound) {
+		t.Errorf("Delete(7) = %v, want ErrVersionNotFound", err)
+	}
+	if err := v.Delete(2); !errors.Is(err, ErrActiveVersion) {
+		t.Errorf("Delete(active) = %v, want ErrActiveVersion", err)
+	}
+	if err := v.Delete(1); err != nil {
+		t.Errorf("Delete(1) = %v", err)
+	}
+	if ids := listIDs(t, v); !slices.Equal(ids, []int{2}) {
+		t.Errorf("versions = %v, want [2]", ids)
+	}
+	assertServing(t, v, 2, "two")
+}
+
+func TestVersionsPrune(t *testing.T) {
+	v := newTestVersions(t, 2)
+	for _, body := range []string{"one", "two", "three"} {
+		addVersion(t, v, body)
+	}
+	if ids := listIDs(t, v); !slices.Equal(ids, []int{2, 3}) {
+		t.Fatalf("versions = %v, want [2 3]", ids)
+	}
+
+	// A rolled-back version is pruned once a new upload replaces it.
+	if _, err := v.Activate(2); err != nil {
+		t.Fatal(err)
+	}
+	addVersion(t, v, "four")
+	if ids := listIDs(t, v); !slices.Equal(ids, []int{3, 4}) {
+		t.Errorf("versions = %v, want [3 4]", ids)
+	}
+}
+
+func TestVersionsPruneSparesActive(t *testing.T) {
+	v := newTestVersions(t, 5)
+	for _, body := range []string{"one", "two", "three"} {
+		addVersion(t, v, body)
+	}
+	if _, err := v.Activate(1); err != nil {
+		t.Fatal(err)
+	}
+
+	v.keep = 1
+	v.prune([]int{1, 2, 3}, 1)
+	if ids := listIDs(t, v); !slices.Equal(ids, []int{1, 3}) {
+		t.Errorf("versions = %v, want the active one and the newest", ids)
+	}
+	assertServing(t, v, 1, "one")
+}
+
+func TestVersionsAdoptLegacyDir(t *testing.T) {
+	v := newTestVersions(t, 5)
+	if err := os.MkdirAll(filepath.Join(v.loginDir, "css"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, body := range map[string]string{"index.html": "legacy", "css/app.css": "body{}"} {
+		if err := os.WriteFile(filepath.Join(v.loginDir, name), []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := addVersion(t, v, "new"); got.ID != 2 {
+		t.Errorf("uploaded version = %d, want 2 after the adopted one", got.ID)
+	}
+	assertServing(t, v, 2, "new")
+
+	if _, err := v.Activate(1); err != nil {
+		t.Fatal(err)
+	}
+	assertServing(t, v, 1, "legacy")
+	if _, err := os.Stat(filepath.Join(v.loginDir, "css", "app.css")); err != nil {
+		t.Errorf("adopted version lost a file: %v", err)
+	}
+}
+
+func TestVersionsEmptyLegacyDir(t *testing.T) {
+	v := newTestVersions(t, 5)
+	if err := os.Mkdir(v.loginDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := addVersion(t, v, "one"); got.ID != 1 {
+		t.Errorf("uploaded version = %d, want 1: an empty dir is not adopted", got.ID)
+	}
+	assertServing(t, v, 1, "one")
+}
+
+func TestVersionsStagingCopy(t *testing.T) {
+	v := newTestVersions(t, 5)
+
+	// Without a login dir the copy starts out empty.
+	dir, base, err := v.StagingCopy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 || base != 0 {
+		t.Errorf("copy of nothing: %d entries, base %d", len(entries), base)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	addVersion(t, v, "one")
+	dir, base, err = v.StagingCopy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base != 1 {
+		t.Errorf("base = %d, want 1", base)
+	}
+	if got, err := os.ReadFile(filepath.Join(dir, "index.html")); err != nil || string(got) != "one" {
+		t.Fatalf("copied index.html = %q, %v", got, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "app.js"), []byte("1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A version activated in the meantime is not silently undone.
+	addVersion(t, v, "two")
+	if _, err := v.AddIfActive(dir, base); !errors.Is(err, ErrVersionChanged) {
+		t.Fatalf("AddIfActive with a stale base = %v, want ErrVersionChanged", err)
+	}
+	assertServing(t, v, 2, "two")
+
+	if _, err := v.Activate(1); err != nil {
+		t.Fatal(err)
+	}
+	version, err := v.AddIfActive(dir, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertServing(t, v, version.ID, "one")
+	if _, err := os.Stat(filepath.Join(v.loginDir, "app.js")); err != nil {
+		t.Errorf("changed file missing: %v", err)
+	}
+}
+
+func TestVersionsRemoveStaleStaging(t *testing.T) {
+	v := newTestVersions(t, 5)
+	addVersion(t, v, "one")
+
+	old := time.Now().Add(-2 * staleStagingAge)
+	stale := filepath.Join(v.root, ".tmp-stale")
+	if err := os.MkdirAll(filepath.Join(stale, "css"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatal(err)
+	}
+	inFlight, err := v.StagingDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Opening the store again, e.g. after a restart, removes the leftover
+	// but not a staging dir that may still be in use.
+	v = NewVersions(v.loginDir, 5)
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("stale staging dir survived: %v", err)
+	}
+	if _, err := os.Stat(inFlight); err != nil {
+		t.Errorf("recent staging dir removed: %v", err)
+	}
+	if ids := listIDs(t, v); !slices.Equal(ids, []int{1}) {
+		t.Errorf("versions = %v, want [1]", ids)
+	}
+	assertServing(t, v, 1, "one")
+}
+
+func TestVersionsChecksums(t *testing.T) {
+	v := newTestVersions(t, 5)
+	if files, err := v.Checksums(); err != nil || len(files) != 0 {
+		t.Fatalf("Checksums without a login dir = %v, %v", files, err)
+	}
+
+	addVersion(t, v, "one")
+	files, err := v.Checksums()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// sha256("one")
+	want := "7692c3ad3540bb803c020b3aee66cd8887123234ea0c6e7143c0add73ff431ed"
+	if len(files) != 1 || files[0].Path != "index.html" || files[0].Bytes != 3 || files[0].SHA256 != want {
+		t.Errorf("Checksums = %+v", files)
+	}
+}
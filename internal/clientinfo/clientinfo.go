@@ -0,0 +1,234 @@
+// Package clientinfo derives the original client's address and scheme from a
+// request, honoring forwarding headers only when they were set by a trusted
+// proxy.
+package clientinfo
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+)
+
+// forwardingHeaders are the headers a proxy sets to describe the client.
+var forwardingHeaders = []string{
+	"Forwarded",
+	"X-Forwarded-For",
+	"X-Forwarded-Proto",
+	"X-Real-IP",
+	"X-Scheme",
+	"CF-Connecting-IP",
+}
+
+type Resolver struct {
+	trustedProxies []netip.Prefix
+	header         string // where trusted proxies put the client address
+	xffIndex       *int   // fixed position in a chain header, nil to walk it from the right
+	warnOnce       sync.Once
+}
+
+// Config configures a Resolver.
+type Config struct {
+	// TrustedProxies are the peers whose forwarding headers are honored.
+	// With none, headers are ignored and the peer address is the client.
+	TrustedProxies []netip.Prefix
+	// ClientIPHeader names the header that carries the client address, e.g.
+	// X-Forwarded-For (the default), Forwarded, CF-Connecting-IP or
+	// X-Real-IP. Other headers are never read, since a proxy passes through
+	// any header it does not set itself.
+	ClientIPHeader string
+	// XForwardedForIndex, when set, picks a fixed element of an
+	// X-Forwarded-For or Forwarded chain instead (0 = leftmost, -1 =
+	// rightmost). Elements left of the closest proxy are client-supplied.
+	XForwardedForIndex *int
+}
+
+// New returns a resolver that trusts forwarding headers only on requests
+// whose immediate peer is inside one of the configured trusted proxies.
+func New(config Config) *Resolver {
+	header := http.CanonicalHeaderKey(config.ClientIPHeader)
+	if header == "" {
+		header = "X-Forwarded-For"
+	}
+	return &Resolver{
+		trustedProxies: config.TrustedProxies,
+		header:         header,
+		xffIndex:       config.XForwardedForIndex,
+	}
+}
+
+// ClientAddr returns the address of the original client. ok is false when
+// no valid address could be determined (e.g. a malformed RemoteAddr).
+//
+// For X-Forwarded-For and Forwarded, the chain is walked from the right,
+// skipping trusted proxies: the first address outside them is the one the
+// closest untrusted hop was connected from, and everything further left
+// could have been made up by the client.
+func (res *Resolver) ClientAddr(r *http.Request) (addr netip.Addr, ok bool) {
+	peer, ok := ParseAddr(r.RemoteAddr)
+	if !ok || !res.trusted(peer) {
+		res.warnUntrusted(r, peer)
+		return peer, ok
+	}
+
+	var chain []string
+	switch res.header {
+	case "X-Forwarded-For":
+		if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+			chain = splitCSV(strings.Join(xff, ","))
+		}
+	case "Forwarded":
+		chain = forwardedValues(r.Header, "for")
+	default:
+		if addr, ok := ParseAddr(r.Header.Get(res.header)); ok {
+			return addr, true
+		}
+		return peer, true
+	}
+
+	if addr, ok := res.fromChain(chain); ok {
+		return addr, true
+	}
+	return peer, true
+}
+
+// fromChain returns the client address from a proxy chain ordered from the
+// client to the closest proxy. ok is false for an empty chain, or when an
+// element that has to be read is not an address.
+func (res *Resolver) fromChain(chain []string) (netip.Addr, bool) {
+	if len(chain) == 0 {
+		return netip.Addr{}, false
+	}
+	if res.xffIndex != nil {
+		return ParseAddr(res.pick(chain))
+	}
+
+	var addr netip.Addr
+	for i := len(chain) - 1; i >= 0; i-- {
+		var ok bool
+		if addr, ok = ParseAddr(chain[i]); !ok {
+			return netip.Addr{}, false
+		}
+		if !res.trusted(addr) {
+			return addr, true
+		}
+	}
+	// Every hop is a trusted proxy; the leftmost one is as far as it goes.
+	return addr, true
+}
+
+// ClientIP is ClientAddr formatted as a string. It falls back to RemoteAddr
+// verbatim when no address could be parsed.
+func (res *Resolver) ClientIP(r *http.Request) string {
+	if addr, ok := res.ClientAddr(r); ok {
+		return addr.String()
+	}
+	return r.RemoteAddr
+}
+
+// Scheme returns "https" or "http" as seen by the client.
+func (res *Resolver) Scheme(r *http.Request) string {
+	peer, ok := ParseAddr(r.RemoteAddr)
+	if ok && res.trusted(peer) {
+		if proto := forwardedValues(r.Header, "proto"); len(proto) > 0 {
+			// The first element was added by the proxy closest to the client.
+			return strings.ToLower(proto[0])
+		}
+
+		if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+			return strings.ToLower(strings.TrimSpace(splitCSV(proto)[0]))
+		}
+
+		if scheme := r.Header.Get("X-Scheme"); scheme != "" {
+			return strings.ToLower(scheme)
+		}
+	} else {
+		res.warnUntrusted(r, peer)
+	}
+
+	if r.TLS != nil {
+		return "https"
+	}
+
+	return "http"
+}
+
+// IsSecure reports whether the client connected over HTTPS.
+func (res *Resolver) IsSecure(r *http.Request) bool {
+	return res.Scheme(r) == "https"
+}
+
+// warnUntrusted logs, once per process, a request with forwarding headers
+// from a peer outside the trusted proxies. It usually means Lana runs behind
+// a proxy that is missing from trusted_proxies, so that client addresses
+// are the proxy's and callback URLs use http instead of https.
+func (res *Resolver) warnUntrusted(r *http.Request, peer netip.Addr) {
+	for _, header := range forwardingHeaders {
+		if r.Header.Get(header) == "" {
+			continue
+		}
+		res.warnOnce.Do(func() {
+			slog.Warn("ignoring forwarding headers from a peer outside server.trusted_proxies; "+
+				"add the proxy's addresses if Lana runs behind one",
+				"peer", peer.String(),
+				"header", header,
+			)
+		})
+		return
+	}
+}
+
+func (res *Resolver) trusted(addr netip.Addr) bool {
+	for _, prefix := range res.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// pick selects an element from a proxy chain using the configured index.
+func (res *Resolver) pick(chain []string) string {
+	index := *res.xffIndex
+	// Support positive indices (0 = first, 1 = second, etc.)
+	if index >= 0 && index < len(chain) {
+		return chain[index]
+	}
+	// Support negative indices (-1 = last, -2 = second-to-last, etc.)
+	if index < 0 && -index <= len(chain) {
+		return chain[len(chain)+index]
+	}
+	// Fallback to first element if index out of bounds
+	return chain[0]
+}
+
+// ParseAddr parses an IP address that may carry a port, square brackets or
+// surrounding whitespace, as found in RemoteAddr and forwarding headers.
+func ParseAddr(s string) (netip.Addr, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return netip.Addr{}, false
+	}
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+func splitCSV(s string) []string {
+	var result []string
+	for i, start := 0, 0; i <= len(s); i++ {
+		if i == len(s) || s[i] == ',' {
+			result = append(result, s[start:i])
+			start = i + 1
+		}
+	}
+	return result
+}
@@ -0,0 +1,359 @@
+package clientinfo
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+var testProxies = []netip.Prefix{
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("fd00::/8"),
+}
+
+func intPtr(i int) *int { return &i }
+
+func newRequest(remoteAddr string, headers ...string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = remoteAddr
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Add(headers[i], headers[i+1])
+	}
+	return r
+}
+
+func TestClientAddr(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		remote  string
+		headers []string // name, value pairs
+		want    string
+		wantOK  bool
+	}{
+		{
+			name:   "no proxies trusted",
+			remote: "203.0.113.7:5000",
+			headers: []string{
+				"X-Forwarded-For", "198.51.100.1",
+				"CF-Connecting-IP", "198.51.100.2",
+			},
+			want:   "203.0.113.7",
+			wantOK: true,
+		},
+		{
+			name:    "headers from an untrusted peer",
+			config:  Config{TrustedProxies: testProxies},
+			remote:  "203.0.113.7:5000",
+			headers: []string{"X-Forwarded-For", "198.51.100.1"},
+			want:    "203.0.113.7",
+			wantOK:  true,
+		},
+		{
+			name:    "client appended by the proxy",
+			config:  Config{TrustedProxies: testProxies},
+			remote:  "10.0.0.2:5000",
+			headers: []string{"X-Forwarded-For", "203.0.113.7"},
+			want:    "203.0.113.7",
+			wantOK:  true,
+		},
+		{
+			name:    "spoofed entry left of the client",
+			config:  Config{TrustedProxies: testProxies},
+			remote:  "10.0.0.2:5000",
+			headers: []string{"X-Forwarded-For", "198.51.100.1, 203.0.113.7"},
+			want:    "203.0.113.7",
+			wantOK:  true,
+		},
+		{
+			name:   "trusted hops are skipped",
+			config: Config{TrustedProxies: testProxies},
+			remote: "10.0.0.2:5000",
+			headers: []string{
+				"X-Forwarded-For", "198.51.100.1, 203.0.113.7",
+				"X-Forwarded-For", "10.1.1.1, 10.2.2.2",
+			},
+			want:   "203.0.113.7",
+			wantOK: true,
+		},
+		{
+			name:    "every hop trusted",
+			config:  Config{TrustedProxies: testProxies},
+			remote:  "10.0.0.2:5000",
+			headers: []string{"X-Forwarded-For", "10.9.9.9, 10.1.1.1"},
+			want:    "10.9.9.9",
+			wantOK:  true,
+		},
+		{
+			name:    "spoofed trusted address left of the client",
+			config:  Config{TrustedProxies: testProxies},
+			remote:  "10.0.0.2:5000",
+			headers: []string{"X-Forwarded-For", "10.9.9.9, 203.0.113.7"},
+			want:    "203.0.113.7",
+			wantOK:  true,
+		},
+		{
+			name:    "malformed hop falls back to the peer",
+			config:  Config{TrustedProxies: testProxies},
+			remote:  "10.0.0.2:5000",
+			headers: []string{"X-Forwarded-For", "203.0.113.7, bogus"},
+			want:    "10.0.0.2",
+			wantOK:  true,
+		},
+		{
+			name:   "IPv6 with ports and brackets",
+			config: Config{TrustedProxies: testProxies},
+			remote: "[fd00::2]:5000",
+			headers: []string{
+				"X-Forwarded-For", "[2001:db8::1]:4711, [fd00::3]",
+			},
+			want:   "2001:db8::1",
+			wantOK: true,
+		},
+		{
+			name:   "CF-Connecting-IP ignored unless configured",
+			config: Config{TrustedProxies: testProxies},
+			remote: "10.0.0.2:5000",
+			headers: []string{
+				"CF-Connecting-IP", "198.51.100.1",
+				"X-Real-IP", "198.51.100.2",
+				"Forwarded", "for=198.51.100.3",
+				"X-Forwarded-For", "203.0.113.7",
+			},
+			want:   "203.0.113.7",
+			wantOK: true,
+		},
+		{
+			name:   "configured CF-Connecting-IP",
+			config: Config{TrustedProxies: testProxies, ClientIPHeader: "cf-connecting-ip"},
+			remote: "10.0.0.2:5000",
+			headers: []string{
+				"CF-Connecting-IP", "198.51.100.1",
+				"X-Forwarded-For", "203.0.113.7",
+			},
+			want:   "198.51.100.1",
+			wantOK: true,
+		},
+		{
+			name:    "configured CF-Connecting-IP from an untrusted peer",
+			config:  Config{TrustedProxies: testProxies, ClientIPHeader: "CF-Connecting-IP"},
+			remote:  "203.0.113.7:5000",
+			headers: []string{"CF-Connecting-IP", "198.51.100.1"},
+			want:    "203.0.113.7",
+			wantOK:  true,
+		},
+		{
+			name:    "configured X-Real-IP missing",
+			config:  Config{TrustedProxies: testProxies, ClientIPHeader: "X-Real-IP"},
+			remote:  "10.0.0.2:5000",
+			headers: []string{"X-Forwarded-For", "203.0.113.7"},
+			want:    "10.0.0.2",
+			wantOK:  true,
+		},
+		{
+			name:   "Forwarded walked from the right",
+			config: Config{TrustedProxies: testProxies, ClientIPHeader: "Forwarded"},
+			remote: "10.0.0.2:5000",
+			headers: []string{
+				"Forwarded", `for=198.51.100.1, for="[2001:db8::1]:4711";proto=https, for=10.1.1.1`,
+				"X-Forwarded-For", "198.51.100.2",
+			},
+			want:   "2001:db8::1",
+			wantOK: true,
+		},
+		{
+			name:    "Forwarded obfuscated hop falls back to the peer",
+			config:  Config{TrustedProxies: testProxies, ClientIPHeader: "Forwarded"},
+			remote:  "10.0.0.2:5000",
+			headers: []string{"Forwarded", "for=203.0.113.7, for=_hidden"},
+			want:    "10.0.0.2",
+			wantOK:  true,
+		},
+		{
+			name:    "Forwarded unknown hop falls back to the peer",
+			config:  Config{TrustedProxies: testProxies, ClientIPHeader: "Forwarded"},
+			remote:  "10.0.0.2:5000",
+			headers: []string{"Forwarded", "for=203.0.113.7, for=unknown"},
+			want:    "10.0.0.2",
+			wantOK:  true,
+		},
+		{
+			name:    "fixed index 0",
+			config:  Config{TrustedProxies: testProxies, XForwardedForIndex: intPtr(0)},
+			remote:  "10.0.0.2:5000",
+			headers: []string{"X-Forwarded-For", "198.51.100.1, 203.0.113.7, 10.1.1.1"},
+			want:    "198.51.100.1",
+			wantOK:  true,
+		},
+		{
+			name:    "fixed negative index",
+			config:  Config{TrustedProxies: testProxies, XForwardedForIndex: intPtr(-2)},
+			remote:  "10.0.0.2:5000",
+			headers: []string{"X-Forwarded-For", "198.51.100.1, 203.0.113.7, 10.1.1.1"},
+			want:    "203.0.113.7",
+			wantOK:  true,
+		},
+		{
+			name:    "fixed index out of range uses the first element",
+			config:  Config{TrustedProxies: testProxies, XForwardedForIndex: intPtr(-5)},
+			remote:  "10.0.0.2:5000",
+			headers: []string{"X-Forwarded-For", "198.51.100.1, 203.0.113.7"},
+			want:    "198.51.100.1",
+			wantOK:  true,
+		},
+		{
+			name:   "no header from a trusted peer",
+			config: Config{TrustedProxies: testProxies},
+			remote: "10.0.0.2:5000",
+			want:   "10.0.0.2",
+			wantOK: true,
+		},
+		{
+			name:   "malformed RemoteAddr",
+			config: Config{TrustedProxies: testProxies},
+			remote: "@",
+			wantOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := New(tt.config)
+			got, ok := res.ClientAddr(newRequest(tt.remote, tt.headers...))
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && got.String() != tt.want {
+				t.Errorf("ClientAddr = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	res := New(Config{})
+	if got := res.ClientIP(newRequest("[::ffff:192.0.2.1]:80")); got != "192.0.2.1" {
+		t.Errorf("ClientIP = %q, want the unmapped address", got)
+	}
+	if got := res.ClientIP(newRequest("@")); got != "@" {
+		t.Errorf("ClientIP = %q, want RemoteAddr verbatim", got)
+	}
+}
+
+func TestScheme(t *testing.T) {
+	tests := []struct {
+		name    string
+		remote  string
+		tls     bool
+		headers []string
+		want    string
+	}{
+		{
+			name:   "plain",
+			remote: "10.0.0.2:5000",
+			want:   "http",
+		},
+		{
+			name:   "TLS",
+			remote: "203.0.113.7:5000",
+			tls:    true,
+			want:   "https",
+		},
+		{
+			name:    "X-Forwarded-Proto from a trusted peer",
+			remote:  "10.0.0.2:5000",
+			headers: []string{"X-Forwarded-Proto", "HTTPS, http"},
+			want:    "https",
+		},
+		{
+			name:    "X-Forwarded-Proto from an untrusted peer",
+			remote:  "203.0.113.7:5000",
+			headers: []string{"X-Forwarded-Proto", "https"},
+			want:    "http",
+		},
+		{
+			name:    "X-Forwarded-Proto from an untrusted peer over TLS",
+			remote:  "203.0.113.7:5000",
+			tls:     true,
+			headers: []string{"X-Forwarded-Proto", "http"},
+			want:    "https",
+		},
+		{
+			name:   "Forwarded takes precedence",
+			remote: "10.0.0.2:5000",
+			headers: []string{
+				"Forwarded", "for=203.0.113.7;proto=https, for=10.1.1.1;proto=http",
+				"X-Forwarded-Proto", "http",
+			},
+			want: "https",
+		},
+		{
+			name:    "X-Scheme",
+			remote:  "10.0.0.2:5000",
+			headers: []string{"X-Scheme", "https"},
+			want:    "https",
+		},
+	}
+
+	res := New(Config{TrustedProxies: testProxies})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRequest(tt.remote, tt.headers...)
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			if got := res.Scheme(r); got != tt.want {
+				t.Errorf("Scheme = %q, want %q", got, tt.want)
+			}
+			if got := res.IsSecure(r); got != (tt.want == "https") {
+				t.Errorf("IsSecure = %v", got)
+			}
+		})
+	}
+}
+
+func TestForwardedValues(t *testing.T) {
+	h := http.Header{}
+	h.Add("Forwarded", `for=192.0.2.60;proto=https;by=203.0.113.43, for="[2001:db8:cafe::17]:4711"`)
+	h.Add("Forwarded", `by=10.0.0.1, For="198.51.100.1,x";proto=http`)
+
+	got := forwardedValues(h, "for")
+	want := []string{"192.0.2.60", "[2001:db8:cafe::17]:4711", "198.51.100.1,x"}
+	if len(got) != len(want) {
+		t.Fatalf("for = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("for[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	if proto := forwardedValues(h, "proto"); len(proto) != 2 || proto[0] != "https" || proto[1] != "http" {
+		t.Errorf("proto = %q", proto)
+	}
+}
+
+func TestParseAddr(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   string
+		wantOK bool
+	}{
+		{"192.0.2.1", "192.0.2.1", true},
+		{" 192.0.2.1:8080 ", "192.0.2.1", true},
+		{"[2001:db8::1]:443", "2001:db8::1", true},
+		{"[2001:db8::1]", "2001:db8::1", true},
+		{"::ffff:192.0.2.1", "192.0.2.1", true},
+		{"", "", false},
+		{"unknown", "", false},
+		{"192.0.2.256", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseAddr(tt.in)
+		if ok != tt.wantOK || (ok && got.String() != tt.want) {
+			t.Errorf("ParseAddr(%q) = %v, %v; want %s, %v", tt.in, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package clientinfo
+
+import (
+	"net/http"
+	"strings"
+)
+
+// forwardedValues returns the value of param in every element of the RFC 7239
+// Forwarded header(s), in order from the client to the closest proxy.
+// Elements lacking param are skipped. Obfuscated identifiers and "unknown"
+// are kept, so that a caller walking the chain stops at them.
+//
+//	Forwarded: for=192.0.2.60;proto=https, for="[2001:db8::17]:4711"
+func forwardedValues(h http.Header, param string) []string {
+	var out []string
+	for _, line := range h.Values("Forwarded") {
+		for _, element := range splitQuoted(line, ',') {
+			for _, pair := range splitQuoted(element, ';') {
+				key, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+				if !found || !strings.EqualFold(key, param) {
+					continue
+				}
+				value = strings.Trim(strings.TrimSpace(value), `"`)
+				if value == "" {
+					continue
+				}
+				out = append(out, value)
+			}
+		}
+	}
+	return out
+}
+
+// splitQuoted splits s on sep, ignoring separators inside double quotes.
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case sep:
+			if !quoted {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
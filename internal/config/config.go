@@ -52,17 +52,60 @@ func validateOAuthProvider(sl validator.StructLevel) {
 type Config struct {
 	Env    string `yaml:"env"       validate:"oneof=development production"`
 	Server struct {
-		Port string `yaml:"port" validate:"gt=0"`
+		Port           string   `yaml:"port" validate:"gt=0"`
+		TrustedProxies []string `yaml:"trusted_proxies" validate:"dive,cidr"`
+		// ClientIPHeader is the one header trusted proxies put the client
+		// address in.
+		ClientIPHeader string `yaml:"client_ip_header"`
 	} `yaml:"server"`
 	Cookie struct {
-		Secret string `yaml:"secret" validate:"required"`
-		Name   string `yaml:"name"`
+		// Secret is shorthand for a single-element Secrets list; when both are
+		// set it is used first.
+		Secret string `yaml:"secret"`
+		// Secrets derive the state cookie keys. The first one encrypts, all of
+		// them decrypt, so a new secret can be rolled out ahead of the old one
+		// being retired.
+		Secrets []string `yaml:"secrets" validate:"required,min=1,dive,min=16"`
+		Name    string   `yaml:"name"`
+		// MaxFlows caps concurrent login flows per browser; each flow has
+		// its own state cookie.
+		MaxFlows int `yaml:"max_flows" validate:"min=1"`
 	} `yaml:"cookie"`
+	State struct {
+		// Store keeps login flows server-side instead of in the state cookie.
+		Store  string `yaml:"store" validate:"oneof=cookie memory sqlite redis"`
+		SQLite struct {
+			Path string `yaml:"path" validate:"required_if=Store sqlite"`
+		} `yaml:"sqlite"`
+		Redis *Redis `yaml:"redis" validate:"required_if=Store redis"`
+		// TTL is how long a login may take, from the redirect to the provider
+		// until the callback.
+		TTL time.Duration `yaml:"ttl" validate:"min=1m,max=1h"`
+		// BindCookie additionally requires the callback to carry the flow's
+		// cookie when a store is used, which protects against login CSRF.
+		BindCookie *bool `yaml:"bind_cookie"`
+	} `yaml:"state"`
 	RateLimit struct {
-		RequestsPerMinute  int           `yaml:"requests_per_minute" validate:"gt=0"`
-		CleanupInterval    time.Duration `yaml:"cleanup_interval"`
-		XForwardedForIndex int           `yaml:"x_forwarded_for_index"`
+		RequestsPerMinute  int             `yaml:"requests_per_minute" validate:"gt=0"`
+		CleanupInterval    time.Duration   `yaml:"cleanup_interval"`
+		XForwardedForIndex *int            `yaml:"x_forwarded_for_index"`
+		Backend            string          `yaml:"backend" validate:"oneof=memory redis"`
+		Redis              *Redis          `yaml:"redis" validate:"required_if=Backend redis"`
+		Rules              []RateLimitRule `yaml:"rules" validate:"unique=Name,dive"`
+		Allowlist          []string        `yaml:"allowlist" validate:"dive,cidr"`
+		ErrorPage          string          `yaml:"error_page" validate:"omitempty,filepath"`
+		IPv6Prefix         int             `yaml:"ipv6_prefix" validate:"min=0,max=128"`
+		Ban                struct {
+			Enabled   bool          `yaml:"enabled"`
+			Threshold int           `yaml:"threshold" validate:"required_if=Enabled true,omitempty,gt=0"`
+			Window    time.Duration `yaml:"window"`
+			Duration  time.Duration `yaml:"duration"`
+		} `yaml:"ban"`
 	} `yaml:"ratelimit"`
+	I18n struct {
+		DefaultLocale string `yaml:"default_locale" validate:"bcp47_language_tag"`
+		CatalogDir    string `yaml:"catalog_dir" validate:"omitempty,dir"`
+	} `yaml:"i18n"`
 	Logging struct {
 		Level  string `yaml:"level" validate:"oneof=debug info warn error"`
 		Format string `yaml:"format" validate:"oneof=text json"`
@@ -73,16 +116,69 @@ type Config struct {
 			Enabled   bool `yaml:"enabled"`
 			GoMetrics bool `yaml:"go_metrics"`
 		} `yaml:"metrics"`
+		Tracing Tracing `yaml:"tracing"`
 	} `yaml:"observability"`
 	Admin struct {
 		Enabled bool `yaml:"enabled"`
 		Port    int  `yaml:"port" validate:"required_if=Enabled true,omitempty,min=1,max=65535"`
+		// AssetVersions is how many uploaded login asset versions are kept
+		// per host.
+		AssetVersions int `yaml:"asset_versions" validate:"min=1"`
+		// Upload bounds login asset uploads so they cannot fill the disk.
+		Upload struct {
+			MaxBytes            int64 `yaml:"max_bytes" validate:"min=1"`
+			MaxEntries          int   `yaml:"max_entries" validate:"min=1"`
+			MaxExtractedBytes   int64 `yaml:"max_extracted_bytes" validate:"min=1"`
+			MaxCompressionRatio int64 `yaml:"max_compression_ratio" validate:"min=1"`
+		} `yaml:"upload"`
+		// HostStoreDir persists hosts created through the admin API. Without
+		// it, hosts can only be configured in this file.
+		HostStoreDir string `yaml:"host_store_dir" validate:"omitempty,dir"`
+		// HostStoreSyncInterval is how often host_store_dir is reloaded, so
+		// that changes made through one replica reach the others.
+		HostStoreSyncInterval time.Duration `yaml:"host_store_sync_interval" validate:"omitempty,min=1s"`
+		// TLS serves the admin listener over HTTPS. ClientCAFile also lets
+		// clients authenticate with a certificate signed by that CA.
+		TLS struct {
+			CertFile     string `yaml:"cert_file" validate:"required_with=KeyFile ClientCAFile,omitempty,file"`
+			KeyFile      string `yaml:"key_file" validate:"required_with=CertFile,omitempty,file"`
+			ClientCAFile string `yaml:"client_ca_file" validate:"omitempty,file"`
+		} `yaml:"tls"`
+		// Auth restricts the admin endpoints. Without any credentials
+		// configured, the admin listener is open to anyone who can reach it.
+		Auth struct {
+			Tokens  []AdminToken  `yaml:"tokens" validate:"unique=Name,dive"`
+			Clients []AdminClient `yaml:"clients" validate:"unique=CommonName,dive"`
+			JWT     *AdminJWT     `yaml:"jwt"`
+		} `yaml:"auth"`
 	} `yaml:"admin"`
 	Hosts map[string]HostConfig `yaml:"hosts"     validate:"required,dive,keys,required,endkeys,required"`
 }
 
 type HostConfig struct {
-	LoginDir            string                   `yaml:"login_dir" validate:"required"`
+	// LoginDir holds the host's login page. When empty, the built-in page
+	// styled by Branding is served.
+	LoginDir string `yaml:"login_dir"`
+	// Template renders the login directory's index.html with html/template,
+	// so pages can list the host's providers instead of hardcoding them.
+	Template bool `yaml:"template" validate:"excluded_without=LoginDir"`
+	// SPAFallback serves index.html for unknown paths without a file
+	// extension, for login apps with client-side routing.
+	SPAFallback bool     `yaml:"spa_fallback" validate:"excluded_without=LoginDir"`
+	Branding    Branding `yaml:"branding"`
+	// Locale is the host's default locale, used when the browser asks for
+	// none that Lana has messages for.
+	Locale string `yaml:"locale" validate:"omitempty,bcp47_language_tag"`
+	// CacheControl sets the Cache-Control header of login assets; the first
+	// rule matching the request path wins.
+	CacheControl []CacheControlRule `yaml:"cache_control" validate:"dive"`
+	// SecurityHeaders overrides the default security headers of the host's
+	// responses.
+	SecurityHeaders SecurityHeaders `yaml:"security_headers"`
+	// ErrorRedirect sends users back to the client app with error and
+	// error_description query parameters instead of showing an error page,
+	// whenever the redirect URL is known.
+	ErrorRedirect       bool                     `yaml:"error_redirect"`
 	AllowedRedirectURLs []string                 `yaml:"allowed_redirect_urls" validate:"required,min=1,dive,required"`
 	Providers           map[string]OAuthProvider `yaml:"providers" validate:"required,dive,keys,required,endkeys,required"`
 	JWT                 struct {
@@ -93,6 +189,107 @@ type HostConfig struct {
 	} `yaml:"jwt"`
 }
 
+// CacheControlRule sets Cache-Control for assets whose request path matches
+// Path, which supports `*` wildcards (e.g. "/assets/*").
+type CacheControlRule struct {
+	Path  string `yaml:"path" validate:"required,startswith=/"`
+	Value string `yaml:"value" validate:"required"`
+}
+
+// SecurityHeaders overrides response security headers. Unset fields keep
+// Lana's defaults; an empty string removes the header. "{nonce}" in the
+// content security policy is replaced with a fresh nonce per response.
+type SecurityHeaders struct {
+	ContentSecurityPolicy   *string `yaml:"content_security_policy"`
+	FrameOptions            *string `yaml:"frame_options" validate:"omitempty,oneof=DENY SAMEORIGIN"`
+	ReferrerPolicy          *string `yaml:"referrer_policy"`
+	StrictTransportSecurity *string `yaml:"strict_transport_security"`
+	PermissionsPolicy       *string `yaml:"permissions_policy"`
+}
+
+// Branding customizes the built-in login page.
+type Branding struct {
+	Title           string `yaml:"title"`
+	LogoURL         string `yaml:"logo_url" validate:"omitempty,url"`
+	PrimaryColor    string `yaml:"primary_color" validate:"omitempty,hexcolor"`
+	BackgroundColor string `yaml:"background_color" validate:"omitempty,hexcolor"`
+	TextColor       string `yaml:"text_color" validate:"omitempty,hexcolor"`
+}
+
+// AdminGrant is what an admin credential may do. Hosts are patterns that
+// support `*` wildcards and limit the login asset and host endpoints; ban
+// endpoints are not host specific.
+type AdminGrant struct {
+	Scopes []string `yaml:"scopes" validate:"required,min=1,dive,oneof=assets:read assets:write bans:read bans:write config:read hosts:write"`
+	Hosts  []string `yaml:"hosts" validate:"dive,required"`
+}
+
+// AdminToken is a static bearer token for the admin listener.
+type AdminToken struct {
+	Name       string `yaml:"name" validate:"required"`
+	Token      string `yaml:"token" validate:"required,min=16"`
+	AdminGrant `yaml:",inline"`
+}
+
+// AdminClient grants access to client certificates with the given subject
+// common name. It requires admin.tls.client_ca_file.
+type AdminClient struct {
+	CommonName string `yaml:"common_name" validate:"required"`
+	AdminGrant `yaml:",inline"`
+}
+
+// AdminJWT accepts bearer JWTs signed by an issuer. Scopes and hosts are
+// read from the token's claims.
+type AdminJWT struct {
+	Issuer   string `yaml:"issuer" validate:"required,url"`
+	Audience string `yaml:"audience" validate:"required"`
+	JWKSURL  string `yaml:"jwks_url" validate:"required,url"`
+	// ScopesClaim holds a space-separated string or a list of scopes.
+	ScopesClaim string `yaml:"scopes_claim"`
+	// HostsClaim holds a list of host patterns.
+	HostsClaim string `yaml:"hosts_claim"`
+}
+
+// Tracing configures OpenTelemetry tracing. The standard OTEL_EXPORTER_OTLP_*
+// environment variables apply to the otlp exporter.
+type Tracing struct {
+	// Exporter is "none" (the default, tracing is disabled), "stdout" (spans
+	// are printed, for debugging) or "otlp" (OTLP over HTTP).
+	Exporter string `yaml:"exporter" validate:"oneof=none stdout otlp"`
+	// Endpoint is the OTLP receiver's host:port. Defaults to localhost:4318.
+	Endpoint string `yaml:"endpoint" validate:"omitempty,hostname_port"`
+	// Insecure sends spans over plain HTTP.
+	Insecure bool `yaml:"insecure"`
+	// SampleRatio is the fraction of requests traced. An incoming trace
+	// context does not override it.
+	SampleRatio *float64 `yaml:"sample_ratio" validate:"omitempty,min=0,max=1"`
+	ServiceName string   `yaml:"service_name"`
+}
+
+// RateLimitRule is a rate limit policy for the requests it matches. Empty
+// Hosts, Methods or Paths match everything; patterns support `*` wildcards.
+type RateLimitRule struct {
+	Name              string   `yaml:"name" validate:"required,ne=default"`
+	Hosts             []string `yaml:"hosts" validate:"dive,required"`
+	Methods           []string `yaml:"methods" validate:"dive,oneof=GET HEAD POST PUT PATCH DELETE OPTIONS"`
+	Paths             []string `yaml:"paths" validate:"dive,required"`
+	RequestsPerMinute int      `yaml:"requests_per_minute" validate:"gt=0"`
+	Burst             int      `yaml:"burst" validate:"gte=0"`
+	Key               string   `yaml:"key" validate:"oneof=ip ip_host ip_host_path global"`
+}
+
+// Redis describes a connection to a Redis-protocol store (Redis, Valkey,
+// KeyDB, Dragonfly, ...).
+type Redis struct {
+	Addr      string        `yaml:"addr" validate:"required,hostname_port"`
+	Username  string        `yaml:"username"`
+	Password  string        `yaml:"password"`
+	DB        int           `yaml:"db" validate:"min=0"`
+	TLS       bool          `yaml:"tls"`
+	KeyPrefix string        `yaml:"key_prefix"`
+	Timeout   time.Duration `yaml:"timeout"`
+}
+
 type OAuthProvider struct {
 	ClientID     string `yaml:"client_id"`
 	ClientSecret string `yaml:"client_secret"`
@@ -104,6 +301,23 @@ type OAuthProvider struct {
 	PrivateKeyFile string `yaml:"private_key_file"`
 }
 
+// ValidateHostName checks that name is a host name, optionally with a port.
+func ValidateHostName(name string) error {
+	if err := validate.Var(name, "hostname_port|hostname_rfc1123"); err != nil {
+		return fmt.Errorf("invalid host name %q", name)
+	}
+	return nil
+}
+
+// ValidateHost validates a host added at runtime the way hosts in the config
+// file are validated.
+func ValidateHost(name string, host HostConfig) error {
+	if err := ValidateHostName(name); err != nil {
+		return err
+	}
+	return validate.Struct(&host)
+}
+
 func New(path string) (cfg Config, err error) {
 	defer func() {
 		if err != nil {
@@ -165,11 +379,40 @@ func applyDefaults(cfg *Config) {
 	if cfg.Server.Port == "" {
 		cfg.Server.Port = "8080"
 	}
+	if cfg.Server.ClientIPHeader == "" {
+		cfg.Server.ClientIPHeader = "X-Forwarded-For"
+	}
 
 	// Cookie defaults
+	if cfg.Cookie.Secret != "" {
+		cfg.Cookie.Secrets = append([]string{cfg.Cookie.Secret}, cfg.Cookie.Secrets...)
+	}
 	if cfg.Cookie.Name == "" {
 		cfg.Cookie.Name = "oauth_state"
 	}
+	if cfg.Cookie.MaxFlows == 0 {
+		cfg.Cookie.MaxFlows = 5
+	}
+
+	// State defaults
+	if cfg.State.Store == "" {
+		cfg.State.Store = "cookie"
+	}
+	if cfg.State.TTL == 0 {
+		cfg.State.TTL = 10 * time.Minute
+	}
+	if cfg.State.BindCookie == nil {
+		bind := true
+		cfg.State.BindCookie = &bind
+	}
+	if r := cfg.State.Redis; r != nil {
+		if r.KeyPrefix == "" {
+			r.KeyPrefix = "lana:state:"
+		}
+		if r.Timeout == 0 {
+			r.Timeout = 500 * time.Millisecond
+		}
+	}
 
 	// Rate limit defaults
 	if cfg.RateLimit.RequestsPerMinute == 0 {
@@ -178,7 +421,71 @@ func applyDefaults(cfg *Config) {
 	if cfg.RateLimit.CleanupInterval == 0 {
 		cfg.RateLimit.CleanupInterval = 5 * time.Minute
 	}
-	// x_forwarded_for_index defaults to 0 (already zero value for int)
+	if cfg.RateLimit.Backend == "" {
+		cfg.RateLimit.Backend = "memory"
+	}
+	if cfg.RateLimit.IPv6Prefix == 0 {
+		cfg.RateLimit.IPv6Prefix = 64
+	}
+	if cfg.RateLimit.Ban.Threshold == 0 {
+		cfg.RateLimit.Ban.Threshold = 20
+	}
+	if cfg.RateLimit.Ban.Window == 0 {
+		cfg.RateLimit.Ban.Window = 10 * time.Minute
+	}
+	if cfg.RateLimit.Ban.Duration == 0 {
+		cfg.RateLimit.Ban.Duration = time.Hour
+	}
+	for i := range cfg.RateLimit.Rules {
+		rule := &cfg.RateLimit.Rules[i]
+		if rule.Burst == 0 {
+			rule.Burst = rule.RequestsPerMinute
+		}
+		if rule.Key == "" {
+			rule.Key = "ip_host"
+		}
+	}
+	if r := cfg.RateLimit.Redis; r != nil {
+		if r.KeyPrefix == "" {
+			r.KeyPrefix = "lana:ratelimit:"
+		}
+		if r.Timeout == 0 {
+			r.Timeout = 100 * time.Millisecond
+		}
+	}
+
+	// I18n defaults
+	if cfg.I18n.DefaultLocale == "" {
+		cfg.I18n.DefaultLocale = "en"
+	}
+
+	// Admin defaults
+	if cfg.Admin.AssetVersions == 0 {
+		cfg.Admin.AssetVersions = 5
+	}
+	if cfg.Admin.Upload.MaxBytes == 0 {
+		cfg.Admin.Upload.MaxBytes = 50 << 20
+	}
+	if cfg.Admin.Upload.MaxEntries == 0 {
+		cfg.Admin.Upload.MaxEntries = 10000
+	}
+	if cfg.Admin.Upload.MaxExtractedBytes == 0 {
+		cfg.Admin.Upload.MaxExtractedBytes = 200 << 20
+	}
+	if cfg.Admin.Upload.MaxCompressionRatio == 0 {
+		cfg.Admin.Upload.MaxCompressionRatio = 100
+	}
+	if cfg.Admin.HostStoreSyncInterval == 0 {
+		cfg.Admin.HostStoreSyncInterval = 10 * time.Second
+	}
+	if j := cfg.Admin.Auth.JWT; j != nil {
+		if j.ScopesClaim == "" {
+			j.ScopesClaim = "scope"
+		}
+		if j.HostsClaim == "" {
+			j.HostsClaim = "hosts"
+		}
+	}
 
 	// Logging defaults
 	if cfg.Logging.Level == "" {
@@ -191,4 +498,14 @@ func applyDefaults(cfg *Config) {
 	// Observability defaults
 	// go_metrics defaults to false (already zero value for bool).
 	// Port is required — validated, no default.
+	if cfg.Observability.Tracing.Exporter == "" {
+		cfg.Observability.Tracing.Exporter = "none"
+	}
+	if cfg.Observability.Tracing.SampleRatio == nil {
+		ratio := 1.0
+		cfg.Observability.Tracing.SampleRatio = &ratio
+	}
+	if cfg.Observability.Tracing.ServiceName == "" {
+		cfg.Observability.Tracing.ServiceName = "lana"
+	}
 }
@@ -0,0 +1,57 @@
+package config
+
+import "maps"
+
+// redacted replaces secret values; unset secrets stay empty so that it is
+// still visible whether they are configured.
+const redacted = "[redacted]"
+
+// Redacted returns a copy of cfg with secrets (cookie secrets, Redis
+// passwords, OAuth client secrets and admin tokens) replaced, for display.
+func Redacted(cfg Config) Config {
+	cfg.Cookie.Secret = redact(cfg.Cookie.Secret)
+	secrets := make([]string, len(cfg.Cookie.Secrets))
+	for i, secret := range cfg.Cookie.Secrets {
+		secrets[i] = redact(secret)
+	}
+	cfg.Cookie.Secrets = secrets
+
+	cfg.State.Redis = redactRedis(cfg.State.Redis)
+	cfg.RateLimit.Redis = redactRedis(cfg.RateLimit.Redis)
+
+	tokens := make([]AdminToken, len(cfg.Admin.Auth.Tokens))
+	for i, token := range cfg.Admin.Auth.Tokens {
+		token.Token = redact(token.Token)
+		tokens[i] = token
+	}
+	cfg.Admin.Auth.Tokens = tokens
+
+	hosts := make(map[string]HostConfig, len(cfg.Hosts))
+	for name, host := range cfg.Hosts {
+		host.Providers = maps.Clone(host.Providers)
+		for providerName, provider := range host.Providers {
+			provider.ClientSecret = redact(provider.ClientSecret)
+			host.Providers[providerName] = provider
+		}
+		hosts[name] = host
+	}
+	cfg.Hosts = hosts
+
+	return cfg
+}
+
+func redactRedis(r *Redis) *Redis {
+	if r == nil {
+		return nil
+	}
+	c := *r
+	c.Password = redact(c.Password)
+	return &c
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redacted
+}
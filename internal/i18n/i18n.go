@@ -0,0 +1,240 @@
+// Package i18n translates the user-facing strings produced by Lana.
+//
+// Messages are keyed by their English text, which is also what is shown when
+// no translation exists. Catalogs are JSON objects mapping keys to
+// translations, named after the locale they hold (e.g. "de.json"); a set is
+// embedded in the binary and more can be loaded from a directory.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/message/catalog"
+)
+
+// CookieName is the cookie a `?lang=` choice is remembered in.
+const CookieName = "lana_lang"
+
+// QueryParam overrides the negotiated locale for a request.
+const QueryParam = "lang"
+
+const cookieMaxAge = 365 * 24 * 60 * 60
+
+//go:embed locales/*.json
+var embedded embed.FS
+
+type Config struct {
+	// DefaultLocale is used when neither the request nor the host's default
+	// picks a supported locale.
+	DefaultLocale string
+	// CatalogDir optionally holds extra catalogs, which take precedence
+	// over embedded ones for the same key.
+	CatalogDir string
+	// HostLocales maps a host to its default locale.
+	HostLocales map[string]string
+}
+
+// Bundle holds the message catalogs and picks a locale per request.
+type Bundle struct {
+	catalog  *catalog.Builder
+	tags     []language.Tag // supported locales, default first
+	matcher  language.Matcher
+	fallback language.Tag
+
+	mu          sync.RWMutex
+	hostLocales map[string]language.Tag
+}
+
+func New(config Config) (*Bundle, error) {
+	fallback, err := language.Parse(config.DefaultLocale)
+	if err != nil {
+		return nil, fmt.Errorf("invalid default locale %q: %w", config.DefaultLocale, err)
+	}
+
+	b := &Bundle{
+		catalog:     catalog.NewBuilder(catalog.Fallback(fallback)),
+		fallback:    fallback,
+		hostLocales: make(map[string]language.Tag),
+	}
+
+	// English is the source language, so it needs no catalog.
+	seen := map[language.Tag]bool{language.English: true}
+	keys := make(map[string]bool)
+	if err := b.load(embedded, "locales", seen, keys); err != nil {
+		return nil, err
+	}
+	if config.CatalogDir != "" {
+		if err := b.load(os.DirFS(config.CatalogDir), ".", seen, keys); err != nil {
+			return nil, err
+		}
+	}
+	// Register keys as their own English translation, or English requests
+	// would get the default locale's translations.
+	for key := range keys {
+		if err := b.catalog.SetString(language.English, key, key); err != nil {
+			return nil, fmt.Errorf("invalid message %q: %w", key, err)
+		}
+	}
+
+	b.tags = []language.Tag{fallback}
+	for tag := range seen {
+		if tag != fallback {
+			b.tags = append(b.tags, tag)
+		}
+	}
+	b.matcher = language.NewMatcher(b.tags)
+
+	for host, locale := range config.HostLocales {
+		if err := b.SetHostLocale(host, locale); err != nil {
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
+
+// load adds every "<locale>.json" catalog in dir of fsys. Files loaded later
+// override earlier translations of the same key.
+func (b *Bundle) load(fsys fs.FS, dir string, seen map[language.Tag]bool, keys map[string]bool) error {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		return fmt.Errorf("could not list catalogs: %w", err)
+	}
+
+	for _, file := range files {
+		tag, err := language.Parse(strings.TrimSuffix(path.Base(file), ".json"))
+		if err != nil {
+			return fmt.Errorf("catalog %s is not named after a locale: %w", file, err)
+		}
+
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return fmt.Errorf("could not read catalog %s: %w", file, err)
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return fmt.Errorf("could not parse catalog %s: %w", file, err)
+		}
+
+		for key, msg := range messages {
+			if err := b.catalog.SetString(tag, key, msg); err != nil {
+				return fmt.Errorf("invalid message %q in catalog %s: %w", key, file, err)
+			}
+			keys[key] = true
+		}
+		seen[tag] = true
+	}
+	return nil
+}
+
+// SetHostLocale sets the locale host falls back to when the request does
+// not pick one. An empty locale clears it.
+func (b *Bundle) SetHostLocale(host, locale string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if locale == "" {
+		delete(b.hostLocales, host)
+		return nil
+	}
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return fmt.Errorf("invalid locale %q for host %s: %w", locale, host, err)
+	}
+	b.hostLocales[host] = b.match(tag.String())
+	return nil
+}
+
+// Locale picks the locale for r from, in order: the `lang` query parameter,
+// the `lana_lang` cookie, Accept-Language, the host's default locale and the
+// bundle's default locale.
+func (b *Bundle) Locale(r *http.Request) language.Tag {
+	if tag, ok := b.supported(r.URL.Query().Get(QueryParam)); ok {
+		return tag
+	}
+	if cookie, err := r.Cookie(CookieName); err == nil {
+		if tag, ok := b.supported(cookie.Value); ok {
+			return tag
+		}
+	}
+	if accept := r.Header.Get("Accept-Language"); accept != "" {
+		if tag, ok := b.supported(accept); ok {
+			return tag
+		}
+	}
+
+	b.mu.RLock()
+	tag, ok := b.hostLocales[r.Host]
+	b.mu.RUnlock()
+	if ok {
+		return tag
+	}
+	return b.fallback
+}
+
+// Printer returns a printer translating into the locale picked for r.
+func (b *Bundle) Printer(r *http.Request) *message.Printer {
+	return message.NewPrinter(b.Locale(r), message.Catalog(b.catalog))
+}
+
+// Sprintf translates key for r and formats it with args. A nil Bundle
+// formats the English key.
+func (b *Bundle) Sprintf(r *http.Request, key string, args ...any) string {
+	if b == nil {
+		return fmt.Sprintf(key, args...)
+	}
+	return b.Printer(r).Sprintf(key, args...)
+}
+
+// Middleware remembers a supported `?lang=` choice in a cookie so that it
+// sticks for the following requests.
+func (b *Bundle) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tag, ok := b.supported(r.URL.Query().Get(QueryParam)); ok {
+			http.SetCookie(w, &http.Cookie{
+				Name:     CookieName,
+				Value:    tag.String(),
+				Path:     "/",
+				MaxAge:   cookieMaxAge,
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// supported matches a locale or Accept-Language value against the
+// catalogs. ok is false when nothing but the fallback would match.
+func (b *Bundle) supported(value string) (language.Tag, bool) {
+	if value == "" {
+		return language.Tag{}, false
+	}
+	tags, _, err := language.ParseAcceptLanguage(value)
+	if err != nil || len(tags) == 0 {
+		return language.Tag{}, false
+	}
+	_, index, confidence := b.matcher.Match(tags...)
+	if confidence == language.No {
+		return language.Tag{}, false
+	}
+	return b.tags[index], true
+}
+
+// match returns the supported locale closest to value, or the fallback.
+func (b *Bundle) match(value string) language.Tag {
+	if tag, ok := b.supported(value); ok {
+		return tag
+	}
+	return b.fallback
+}
@@ -11,6 +11,8 @@ func Middleware(next http.Handler) http.Handler {
 	config := sloghttp.Config{
 		DefaultLevel:     slog.LevelInfo,
 		ServerErrorLevel: slog.LevelError,
+		WithTraceID:      true,
+		WithSpanID:       true,
 	}
 
 	return sloghttp.NewWithConfig(slog.Default(), config)(next)
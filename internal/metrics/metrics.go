@@ -1,6 +1,9 @@
 package metrics
 
 import (
+	"runtime"
+	"runtime/debug"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
@@ -15,9 +18,41 @@ var (
 	// AuthenticationsTotal tracks authentication attempts
 	AuthenticationsTotal *prometheus.CounterVec
 
+	// RateLimitRejectionsTotal tracks requests rejected by the rate limiter
+	RateLimitRejectionsTotal *prometheus.CounterVec
+
+	// UpstreamRequestDuration tracks the latency of requests to OAuth
+	// providers
+	UpstreamRequestDuration *prometheus.HistogramVec
+
+	// UpstreamResponsesTotal tracks responses from OAuth providers by status
+	// class
+	UpstreamResponsesTotal *prometheus.CounterVec
+
+	// OIDCVerificationFailuresTotal tracks ID tokens that failed verification
+	OIDCVerificationFailuresTotal *prometheus.CounterVec
+
+	// JWTSigningDuration tracks how long signing issued JWTs takes
+	JWTSigningDuration *prometheus.HistogramVec
+
+	// StateDecryptFailuresTotal tracks state cookies that could not be
+	// decrypted
+	StateDecryptFailuresTotal *prometheus.CounterVec
+
+	// BuildInfo is always 1, labeled with the running build
+	BuildInfo *prometheus.GaugeVec
+
 	enabled bool
 )
 
+// Version and Revision identify the build in lana_build_info. They are set
+// with -ldflags "-X github.com/iamolegga/lana/internal/metrics.Version=...";
+// otherwise they are taken from the Go build info.
+var (
+	Version  string
+	Revision string
+)
+
 // Init initializes the metrics system. Metrics are exposed on the observability
 // listener only when enabled is true; otherwise collectors are not registered
 // and Record* helpers are no-ops.
@@ -73,6 +108,114 @@ func Init(enable bool, goMetrics bool) {
 		},
 		[]string{"provider", "host", "status", "reason"},
 	)
+
+	// Initialize rate limit rejection counter
+	RateLimitRejectionsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "lana_ratelimit_rejections_total",
+			Help: "Total number of requests rejected by the rate limiter",
+		},
+		[]string{"host", "route_class"},
+	)
+
+	// Initialize upstream request duration histogram
+	UpstreamRequestDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "lana_upstream_request_duration_seconds",
+			Help: "Latency of requests to OAuth providers in seconds",
+			Buckets: []float64{
+				0.025,
+				0.05,
+				0.1,
+				0.25,
+				0.5,
+				1.0,
+				2.5,
+				5.0,
+				10.0,
+			},
+		},
+		[]string{"provider", "operation"},
+	)
+
+	// Initialize upstream response counter
+	UpstreamResponsesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "lana_upstream_responses_total",
+			Help: "Total number of responses from OAuth providers by status class",
+		},
+		[]string{"provider", "operation", "status_class"},
+	)
+
+	// Initialize OIDC verification failure counter
+	OIDCVerificationFailuresTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "lana_oidc_verification_failures_total",
+			Help: "Total number of ID tokens that failed verification",
+		},
+		[]string{"provider", "reason"},
+	)
+
+	// Initialize JWT signing duration histogram
+	JWTSigningDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "lana_jwt_signing_duration_seconds",
+			Help: "Time spent signing issued JWTs in seconds",
+			Buckets: []float64{
+				0.0005,
+				0.001,
+				0.0025,
+				0.005,
+				0.01,
+				0.025,
+				0.05,
+			},
+		},
+		[]string{"host"},
+	)
+
+	// Initialize state decrypt failure counter
+	StateDecryptFailuresTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "lana_state_decrypt_failures_total",
+			Help: "Total number of state cookies that could not be decrypted",
+		},
+		[]string{"reason"},
+	)
+
+	// Initialize build info gauge
+	BuildInfo = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "lana_build_info",
+			Help: "Always 1, labeled with the version, VCS revision and Go version of the build",
+		},
+		[]string{"version", "revision", "go_version"},
+	)
+	version, revision := buildVersion()
+	BuildInfo.WithLabelValues(version, revision, runtime.Version()).Set(1)
+}
+
+// buildVersion returns Version and Revision, falling back to the module
+// version and VCS revision recorded by the Go toolchain.
+func buildVersion() (version, revision string) {
+	version, revision = Version, Revision
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if version == "" {
+			version = info.Main.Version
+		}
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" && revision == "" {
+				revision = setting.Value
+			}
+		}
+	}
+	if version == "" {
+		version = "unknown"
+	}
+	if revision == "" {
+		revision = "unknown"
+	}
+	return version, revision
 }
 
 // Enabled reports whether metrics collection is turned on.
@@ -103,3 +246,48 @@ func RecordAuthentication(provider, host, status, reason string) {
 	}
 	AuthenticationsTotal.WithLabelValues(provider, host, status, reason).Inc()
 }
+
+// RecordRateLimitRejection records a request rejected by the rate limiter.
+// routeClass is the name of the rate limit rule that matched.
+func RecordRateLimitRejection(host, routeClass string) {
+	if !enabled {
+		return
+	}
+	RateLimitRejectionsTotal.WithLabelValues(host, routeClass).Inc()
+}
+
+// RecordUpstreamRequest records a request to an OAuth provider. operation is
+// "token_exchange" or "userinfo"; statusClass is "2xx" to "5xx", or "error"
+// when no response was received.
+func RecordUpstreamRequest(provider, operation, statusClass string, duration float64) {
+	if !enabled {
+		return
+	}
+	UpstreamRequestDuration.WithLabelValues(provider, operation).Observe(duration)
+	UpstreamResponsesTotal.WithLabelValues(provider, operation, statusClass).Inc()
+}
+
+// RecordOIDCVerificationFailure records an ID token that failed verification
+func RecordOIDCVerificationFailure(provider, reason string) {
+	if !enabled {
+		return
+	}
+	OIDCVerificationFailuresTotal.WithLabelValues(provider, reason).Inc()
+}
+
+// RecordJWTSigning records how long signing a JWT took
+func RecordJWTSigning(host string, duration float64) {
+	if !enabled {
+		return
+	}
+	JWTSigningDuration.WithLabelValues(host).Observe(duration)
+}
+
+// RecordStateDecryptFailure records a state cookie that could not be
+// decrypted
+func RecordStateDecryptFailure(reason string) {
+	if !enabled {
+		return
+	}
+	StateDecryptFailuresTotal.WithLabelValues(reason).Inc()
+}
@@ -25,11 +25,15 @@ type TokenResponse struct {
 }
 
 type Provider interface {
-	GetAuthURL(state string, redirectURL string) (authURL string, codeVerifier string)
+	// GetAuthURL builds the provider's authorization URL. OpenID Connect
+	// providers bind nonce to the ID token they issue; others ignore it.
+	GetAuthURL(state string, redirectURL string, nonce string) (authURL string, codeVerifier string)
 
 	ExchangeCode(ctx context.Context, code string, redirectURL string, codeVerifier string) (*TokenResponse, error)
 
-	GetUser(ctx context.Context, tokens *TokenResponse) (*User, error)
+	// GetUser extracts the user from tokens. OpenID Connect providers reject
+	// ID tokens whose nonce differs from the one passed to GetAuthURL.
+	GetUser(ctx context.Context, tokens *TokenResponse, nonce string) (*User, error)
 
 	Name() string
 }
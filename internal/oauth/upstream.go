@@ -0,0 +1,67 @@
+package oauth
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/iamolegga/lana/internal/metrics"
+	"github.com/iamolegga/lana/internal/tracing"
+)
+
+// Upstream operations, the operation label of upstream request metrics.
+const (
+	OperationTokenExchange = "token_exchange"
+	OperationUserInfo      = "userinfo"
+)
+
+// UpstreamClient is for providers' requests to their upstream APIs. Each
+// request is recorded as a client span and in the upstream request metrics.
+var UpstreamClient = &http.Client{
+	Timeout:   10 * time.Second,
+	Transport: &upstreamTransport{next: tracing.Transport(nil)},
+}
+
+// UpstreamContext returns a context for requests to a provider's upstream.
+// It keeps the values of ctx, such as the current span, but not its
+// cancellation, so an exchange finishes even if the browser goes away, and
+// makes oauth2 and go-oidc use UpstreamClient.
+func UpstreamContext(ctx context.Context) context.Context {
+	return context.WithValue(context.WithoutCancel(ctx), oauth2.HTTPClient, UpstreamClient)
+}
+
+type upstreamCallKey struct{}
+
+type upstreamCall struct {
+	provider  string
+	operation string
+}
+
+// WithOperation labels the upstream requests made with ctx, or a context
+// derived from it, with provider and operation.
+func WithOperation(ctx context.Context, provider, operation string) context.Context {
+	return context.WithValue(ctx, upstreamCallKey{}, upstreamCall{provider: provider, operation: operation})
+}
+
+type upstreamTransport struct {
+	next http.RoundTripper
+}
+
+func (t *upstreamTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+
+	call, ok := req.Context().Value(upstreamCallKey{}).(upstreamCall)
+	if !ok {
+		call = upstreamCall{provider: "unknown", operation: "other"}
+	}
+	statusClass := "error"
+	if err == nil {
+		statusClass = strconv.Itoa(resp.StatusCode/100) + "xx"
+	}
+	metrics.RecordUpstreamRequest(call.provider, call.operation, statusClass, time.Since(start).Seconds())
+	return resp, err
+}
@@ -0,0 +1,55 @@
+package oauth
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/iamolegga/lana/internal/metrics"
+)
+
+var (
+	// ErrIDTokenMissing is returned when an OpenID Connect provider's token
+	// response has no ID token.
+	ErrIDTokenMissing = errors.New("id_token not found in OAuth response")
+	// ErrNonceMismatch is returned for an ID token issued for another login.
+	ErrNonceMismatch = errors.New("ID token nonce mismatch")
+)
+
+// RecordVerificationFailure counts an ID token that failed verification in
+// lana_oidc_verification_failures_total, with a reason derived from err.
+func RecordVerificationFailure(provider string, err error) {
+	metrics.RecordOIDCVerificationFailure(provider, verificationFailureReason(err))
+}
+
+func verificationFailureReason(err error) string {
+	switch {
+	case errors.Is(err, ErrIDTokenMissing):
+		return "missing_token"
+	case errors.Is(err, ErrNonceMismatch):
+		return "nonce"
+	}
+
+	// go-oidc v2 reports verification failures only by message.
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "failed to verify signature"):
+		return "signature"
+	case strings.Contains(msg, "unsupported algorithm"):
+		return "algorithm"
+	case strings.Contains(msg, "issued by a different provider"):
+		return "issuer"
+	case strings.Contains(msg, "expected audience"):
+		return "audience"
+	case strings.Contains(msg, "token is expired"):
+		return "expired"
+	case strings.Contains(msg, "before the nbf"):
+		return "not_yet_valid"
+	case strings.Contains(msg, "malformed jwt"),
+		strings.Contains(msg, "not signed"),
+		strings.Contains(msg, "multiple signatures"),
+		strings.Contains(msg, "unmarshal claims"):
+		return "malformed"
+	default:
+		return "other"
+	}
+}
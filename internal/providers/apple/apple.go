@@ -20,6 +20,7 @@ import (
 
 	"github.com/iamolegga/lana/internal/config"
 	"github.com/iamolegga/lana/internal/oauth"
+	"github.com/iamolegga/lana/internal/tracing"
 )
 
 type Provider struct {
@@ -72,7 +73,7 @@ func New(providerConfig *config.OAuthProvider) (oauth.Provider, error) {
 	}, nil
 }
 
-func (p *Provider) GetAuthURL(state string, redirectURL string) (string, string) {
+func (p *Provider) GetAuthURL(state string, redirectURL string, nonce string) (string, string) {
 	configCopy := *p.config
 	configCopy.RedirectURL = redirectURL
 
@@ -81,6 +82,7 @@ func (p *Provider) GetAuthURL(state string, redirectURL string) (string, string)
 		state,
 		oauth2.SetAuthURLParam("response_mode", "form_post"),
 		oauth2.SetAuthURLParam("response_type", "code"),
+		oidc.Nonce(nonce),
 	), ""
 }
 
@@ -94,7 +96,7 @@ func (p *Provider) ExchangeCode(ctx context.Context, code string, redirectURL st
 	configCopy.RedirectURL = redirectURL
 	configCopy.ClientSecret = clientSecret
 
-	exchangeCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	exchangeCtx, cancel := context.WithTimeout(oauth.UpstreamContext(ctx), 10*time.Second)
 	defer cancel()
 
 	slog.Debug("exchanging authorization code for token", "provider", "apple")
@@ -118,21 +120,22 @@ func (p *Provider) ExchangeCode(ctx context.Context, code string, redirectURL st
 	return response, nil
 }
 
-func (p *Provider) GetUser(ctx context.Context, tokens *oauth.TokenResponse) (*oauth.User, error) {
+func (p *Provider) GetUser(ctx context.Context, tokens *oauth.TokenResponse, nonce string) (*oauth.User, error) {
 	if tokens.IDToken == "" {
 		slog.Error("id_token not found in OAuth response", "provider", "apple")
-		return nil, fmt.Errorf("id_token not found in OAuth response")
+		oauth.RecordVerificationFailure("apple", oauth.ErrIDTokenMissing)
+		return nil, oauth.ErrIDTokenMissing
 	}
 
 	httpClient := &http.Client{
 		Timeout: 10 * time.Second,
-		Transport: &http.Transport{
+		Transport: tracing.Transport(&http.Transport{
 			TLSHandshakeTimeout:   5 * time.Second,
 			ResponseHeaderTimeout: 5 * time.Second,
 			ExpectContinueTimeout: 1 * time.Second,
 			DisableKeepAlives:     true,
 			MaxIdleConnsPerHost:   -1,
-		},
+		}),
 	}
 
 	verifyCtx := oidc.ClientContext(ctx, httpClient)
@@ -144,9 +147,16 @@ func (p *Provider) GetUser(ctx context.Context, tokens *oauth.TokenResponse) (*o
 	idToken, err := verifier.Verify(verifyCtx, tokens.IDToken)
 	if err != nil {
 		slog.Error("failed to verify ID token", "provider", "apple", "error", err)
+		oauth.RecordVerificationFailure("apple", err)
 		return nil, fmt.Errorf("failed to verify ID token: %w", err)
 	}
 
+	if idToken.Nonce != nonce {
+		slog.Error("ID token nonce mismatch", "provider", "apple")
+		oauth.RecordVerificationFailure("apple", oauth.ErrNonceMismatch)
+		return nil, oauth.ErrNonceMismatch
+	}
+
 	var claims struct {
 		Email         string `json:"email"`
 		EmailVerified bool   `json:"email_verified"`
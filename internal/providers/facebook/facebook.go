@@ -41,7 +41,7 @@ func New(providerConfig *config.OAuthProvider) (oauth.Provider, error) {
 	}, nil
 }
 
-func (p *Provider) GetAuthURL(state string, redirectURL string) (string, string) {
+func (p *Provider) GetAuthURL(state string, redirectURL string, _ string) (string, string) {
 	configCopy := *p.config
 	configCopy.RedirectURL = redirectURL
 
@@ -53,7 +53,7 @@ func (p *Provider) ExchangeCode(ctx context.Context, code string, redirectURL st
 	configCopy := *p.config
 	configCopy.RedirectURL = redirectURL
 
-	exchangeCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	exchangeCtx, cancel := context.WithTimeout(oauth.UpstreamContext(ctx), 10*time.Second)
 	defer cancel()
 
 	slog.Debug("exchanging authorization code for token", "provider", "facebook")
@@ -73,8 +73,8 @@ func (p *Provider) ExchangeCode(ctx context.Context, code string, redirectURL st
 	return response, nil
 }
 
-func (p *Provider) GetUser(ctx context.Context, tokens *oauth.TokenResponse) (*oauth.User, error) {
-	userCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (p *Provider) GetUser(ctx context.Context, tokens *oauth.TokenResponse, _ string) (*oauth.User, error) {
+	userCtx, cancel := context.WithTimeout(oauth.UpstreamContext(ctx), 10*time.Second)
 	defer cancel()
 
 	slog.Debug("fetching user info from facebook", "provider", "facebook")
@@ -117,8 +117,7 @@ func (p *Provider) fetchUserInfo(ctx context.Context, accessToken string) (*Face
 		return nil, fmt.Errorf("creating request: %w", err)
 	}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := oauth.UpstreamClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("making request: %w", err)
 	}
@@ -3,7 +3,6 @@ package google
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -16,6 +15,7 @@ import (
 
 	"github.com/iamolegga/lana/internal/config"
 	"github.com/iamolegga/lana/internal/oauth"
+	"github.com/iamolegga/lana/internal/tracing"
 )
 
 type Provider struct {
@@ -52,19 +52,19 @@ func New(providerConfig *config.OAuthProvider) (oauth.Provider, error) {
 	}, nil
 }
 
-func (p *Provider) GetAuthURL(state string, redirectURL string) (string, string) {
+func (p *Provider) GetAuthURL(state string, redirectURL string, nonce string) (string, string) {
 	configCopy := *p.config
 	configCopy.RedirectURL = redirectURL
 
 	slog.Debug("generating authorization url", "provider", "google", "redirect_uri", redirectURL)
-	return configCopy.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.ApprovalForce), ""
+	return configCopy.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.ApprovalForce, oidc.Nonce(nonce)), ""
 }
 
 func (p *Provider) ExchangeCode(ctx context.Context, code string, redirectURL string, _ string) (*oauth.TokenResponse, error) {
 	configCopy := *p.config
 	configCopy.RedirectURL = redirectURL
 
-	exchangeCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	exchangeCtx, cancel := context.WithTimeout(oauth.UpstreamContext(ctx), 10*time.Second)
 	defer cancel()
 
 	slog.Debug("exchanging authorization code for token", "provider", "google")
@@ -88,21 +88,22 @@ func (p *Provider) ExchangeCode(ctx context.Context, code string, redirectURL st
 	return response, nil
 }
 
-func (p *Provider) GetUser(ctx context.Context, tokens *oauth.TokenResponse) (*oauth.User, error) {
+func (p *Provider) GetUser(ctx context.Context, tokens *oauth.TokenResponse, nonce string) (*oauth.User, error) {
 	if tokens.IDToken == "" {
 		slog.Error("id_token not found in OAuth response", "provider", "google")
-		return nil, errors.New("id_token not found in OAuth response")
+		oauth.RecordVerificationFailure("google", oauth.ErrIDTokenMissing)
+		return nil, oauth.ErrIDTokenMissing
 	}
 
 	httpClient := &http.Client{
 		Timeout: 10 * time.Second,
-		Transport: &http.Transport{
+		Transport: tracing.Transport(&http.Transport{
 			TLSHandshakeTimeout:   5 * time.Second,
 			ResponseHeaderTimeout: 5 * time.Second,
 			ExpectContinueTimeout: 1 * time.Second,
 			DisableKeepAlives:     true,
 			MaxIdleConnsPerHost:   -1,
-		},
+		}),
 	}
 
 	verifyCtx := oidc.ClientContext(ctx, httpClient)
@@ -114,9 +115,16 @@ func (p *Provider) GetUser(ctx context.Context, tokens *oauth.TokenResponse) (*o
 	idToken, err := verifier.Verify(verifyCtx, tokens.IDToken)
 	if err != nil {
 		slog.Error("failed to verify ID token", "provider", "google", "error", err)
+		oauth.RecordVerificationFailure("google", err)
 		return nil, fmt.Errorf("failed to verify ID token: %w", err)
 	}
 
+	if idToken.Nonce != nonce {
+		slog.Error("ID token nonce mismatch", "provider", "google")
+		oauth.RecordVerificationFailure("google", oauth.ErrNonceMismatch)
+		return nil, oauth.ErrNonceMismatch
+	}
+
 	var claims struct {
 		Email         string `json:"email"`
 		EmailVerified bool   `json:"email_verified"`
@@ -169,7 +177,7 @@ func (p *Provider) fetchUserInfo(ctx context.Context, accessToken string) (*stru
 }, error) {
 	userinfoURL := "https://www.googleapis.com/oauth2/v3/userinfo"
 
-	userinfoCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	userinfoCtx, cancel := context.WithTimeout(oauth.UpstreamContext(ctx), 10*time.Second)
 	defer cancel()
 
 	req, err := http.NewRequestWithContext(userinfoCtx, http.MethodGet, userinfoURL, nil)
@@ -178,7 +186,7 @@ func (p *Provider) fetchUserInfo(ctx context.Context, accessToken string) (*stru
 	}
 	req.Header.Set("Authorization", "Bearer "+accessToken)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := oauth.UpstreamClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -46,6 +46,7 @@ func New(providerConfig *config.OAuthProvider) (oauth.Provider, error) {
 func (p *Provider) GetAuthURL(
 	state string,
 	redirectURL string,
+	_ string,
 ) (string, string) {
 	configCopy := *p.config
 	configCopy.RedirectURL = redirectURL
@@ -75,7 +76,7 @@ func (p *Provider) ExchangeCode(
 	configCopy.RedirectURL = redirectURL
 
 	exchangeCtx, cancel := context.WithTimeout(
-		context.Background(),
+		oauth.UpstreamContext(ctx),
 		10*time.Second,
 	)
 	defer cancel()
@@ -110,8 +111,9 @@ func (p *Provider) ExchangeCode(
 func (p *Provider) GetUser(
 	ctx context.Context,
 	tokens *oauth.TokenResponse,
+	_ string,
 ) (*oauth.User, error) {
-	userCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	userCtx, cancel := context.WithTimeout(oauth.UpstreamContext(ctx), 10*time.Second)
 	defer cancel()
 
 	slog.Debug("fetching user info from x", "provider", "x")
@@ -160,8 +162,7 @@ func (p *Provider) fetchUserInfo(
 	}
 	req.Header.Set("Authorization", "Bearer "+accessToken)
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := oauth.UpstreamClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("making request: %w", err)
 	}
@@ -0,0 +1,149 @@
+package ratelimit
+
+import (
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BanConfig controls escalation from rate limiting to temporary bans.
+type BanConfig struct {
+	Enabled   bool
+	Threshold int           // violations within Window that trigger a ban
+	Window    time.Duration // fixed window violations are counted in
+	Duration  time.Duration // how long a ban lasts
+}
+
+// Ban is a client that is currently banned.
+type Ban struct {
+	Client string    `json:"client"`
+	Reason string    `json:"reason"`
+	Until  time.Time `json:"until"`
+}
+
+type offender struct {
+	violations  int
+	windowStart time.Time
+	bannedUntil time.Time
+	reason      string
+}
+
+// Bans tracks misbehaving clients and bans them once they accumulate
+// Threshold violations within Window. State is kept per replica.
+type Bans struct {
+	config    BanConfig
+	mu        sync.Mutex
+	offenders map[string]*offender // key: client key (IP or IPv6 prefix)
+}
+
+func NewBans(config BanConfig) *Bans {
+	return &Bans{
+		config:    config,
+		offenders: make(map[string]*offender),
+	}
+}
+
+// Banned reports whether client is banned and for how much longer.
+func (b *Bans) Banned(client string) (time.Duration, bool) {
+	if !b.config.Enabled {
+		return 0, false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	o, ok := b.offenders[client]
+	if !ok {
+		return 0, false
+	}
+	left := time.Until(o.bannedUntil)
+	return left, left > 0
+}
+
+// Violation records misbehaviour by client and bans it when the threshold is
+// reached.
+func (b *Bans) Violation(client, reason string) {
+	if !b.config.Enabled {
+		return
+	}
+
+	now := time.Now()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	o, ok := b.offenders[client]
+	if !ok {
+		o = &offender{windowStart: now}
+		b.offenders[client] = o
+	}
+	if now.Before(o.bannedUntil) {
+		return
+	}
+	if now.Sub(o.windowStart) > b.config.Window {
+		o.violations = 0
+		o.windowStart = now
+	}
+
+	o.violations++
+	if o.violations < b.config.Threshold {
+		return
+	}
+
+	o.bannedUntil = now.Add(b.config.Duration)
+	o.reason = reason
+	o.violations = 0
+	slog.Warn("client banned",
+		"client", client,
+		"reason", reason,
+		"duration", b.config.Duration,
+	)
+}
+
+// List returns active bans ordered by expiry.
+func (b *Bans) List() []Ban {
+	now := time.Now()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	bans := make([]Ban, 0)
+	for client, o := range b.offenders {
+		if now.Before(o.bannedUntil) {
+			bans = append(bans, Ban{Client: client, Reason: o.reason, Until: o.bannedUntil})
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Until.Before(bans[j].Until)
+	})
+	return bans
+}
+
+// Clear lifts the ban on client and forgets its violations. It reports
+// whether client was banned.
+func (b *Bans) Clear(client string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	o, ok := b.offenders[client]
+	if !ok {
+		return false
+	}
+	delete(b.offenders, client)
+	return time.Now().Before(o.bannedUntil)
+}
+
+// cleanup forgets clients that are neither banned nor inside a window.
+func (b *Bans) cleanup() {
+	now := time.Now()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for client, o := range b.offenders {
+		if now.After(o.bannedUntil) && now.Sub(o.windowStart) > b.config.Window {
+			delete(b.offenders, client)
+		}
+	}
+}
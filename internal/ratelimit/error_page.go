@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// pageRecheckInterval is how long a cached error page is served before its
+// file is checked for changes again, so that a flood of rejections costs
+// neither a read nor a stat per request.
+const pageRecheckInterval = time.Second
+
+type cachedPage struct {
+	modTime   time.Time
+	checkedAt time.Time
+	body      []byte
+}
+
+// pageCache keeps the 429 error pages in memory and rereads a file when its
+// modification time changes, e.g. after an asset upload.
+type pageCache struct {
+	mu    sync.Mutex
+	pages map[string]cachedPage // key: file path
+}
+
+func newPageCache() *pageCache {
+	return &pageCache{pages: make(map[string]cachedPage)}
+}
+
+func (c *pageCache) get(path string) ([]byte, error) {
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cached, ok := c.pages[path]
+	if ok && now.Sub(cached.checkedAt) < pageRecheckInterval {
+		return cached.body, nil
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		delete(c.pages, path)
+		return nil, err
+	}
+	if ok && cached.modTime.Equal(stat.ModTime()) {
+		cached.checkedAt = now
+		c.pages[path] = cached
+		return cached.body, nil
+	}
+
+	body, err := os.ReadFile(path)
+	if err != nil {
+		delete(c.pages, path)
+		return nil, err
+	}
+	c.pages[path] = cachedPage{modTime: stat.ModTime(), checkedAt: now, body: body}
+	return body, nil
+}
@@ -3,37 +3,101 @@ package ratelimit
 import (
 	"context"
 	"log/slog"
+	"math"
 	"net/http"
-	"sync"
+	"net/netip"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
 	"time"
 
-	"golang.org/x/time/rate"
+	"github.com/iamolegga/lana/internal/clientinfo"
+	"github.com/iamolegga/lana/internal/i18n"
+	"github.com/iamolegga/lana/internal/metrics"
 )
 
 type Limiter interface {
 	Limit(next http.Handler) http.Handler
+	// Violation records misbehaviour (e.g. a forged OAuth callback) by the
+	// client of r; repeat offenders get banned.
+	Violation(r *http.Request, reason string)
 }
 
+// Hosts reports the hosts being served, which can change at runtime.
+type Hosts interface {
+	// LoginDir returns host's login directory, empty for the built-in login
+	// page. ok is false when host is not served.
+	LoginDir(host string) (dir string, ok bool)
+}
+
+// unknownHost labels rejection metrics for requests to hosts that are not
+// served, so that made-up Host headers cannot create new series.
+const unknownHost = "unknown"
+
+// fallbackCooldown is how long the limiter keeps using local buckets after
+// the shared store failed, before it tries the store again.
+const fallbackCooldown = 5 * time.Second
+
 type RateLimiter struct {
-	store            sync.Map // key: ip|host|path -> *rate.Limiter
-	requestsPerMin   int
+	store            Store        // shared store, nil when limiting locally
+	local            *MemoryStore // used when store is nil or unreachable
+	storeDownUntil   atomic.Int64 // unix nanos; store is skipped until then
+	rules            []Rule
+	defaultRule      Rule
+	allowlist        []netip.Prefix
+	errorPage        string
+	hosts            Hosts
+	pages            *pageCache
+	ipv6Prefix       int
+	bans             *Bans
 	cleanupInterval  time.Duration
-	xffIndex         int // index for X-Forwarded-For, supports negative indices
+	clientInfo       *clientinfo.Resolver
+	messages         *i18n.Bundle
 	shutdownComplete chan struct{}
 }
 
 type Config struct {
-	RequestsPerMinute  int
-	CleanupInterval    time.Duration
-	XForwardedForIndex int // index for X-Forwarded-For, supports negative indices
+	RequestsPerMinute int // budget for requests that match no rule
+	CleanupInterval   time.Duration
+	ClientInfo        *clientinfo.Resolver
+	Rules             []Rule         // evaluated in order, first match wins
+	Allowlist         []netip.Prefix // clients in these ranges are never limited
+	// ErrorPage is an HTML file, relative to a host's login directory,
+	// served with 429 responses. Hosts without a login directory, or whose
+	// file is missing, get a plain-text body.
+	ErrorPage string
+	// IPv6Prefix is the prefix length IPv6 clients are grouped by, since a
+	// single client usually controls a whole /64.
+	IPv6Prefix int
+	Bans       BanConfig
+	// Messages translates the plain-text 429 body. Optional.
+	Messages *i18n.Bundle
 }
 
-func New(ctx context.Context, config Config, _ any) *RateLimiter {
+// New creates a rate limiter. When store is nil buckets are kept in process
+// memory; otherwise store is used and local buckets serve as a fallback while
+// it is unreachable.
+func New(ctx context.Context, config Config, store Store) *RateLimiter {
 	limiter := &RateLimiter{
-		store:            sync.Map{},
-		requestsPerMin:   config.RequestsPerMinute,
+		store: store,
+		local: NewMemoryStore(),
+		rules: config.Rules,
+		defaultRule: Rule{
+			Name: defaultRuleName,
+			Rate: Rate{
+				PerMinute: config.RequestsPerMinute,
+				Burst:     config.RequestsPerMinute,
+			},
+			Key: KeyIPHostPath,
+		},
+		allowlist:        config.Allowlist,
+		errorPage:        config.ErrorPage,
+		pages:            newPageCache(),
+		ipv6Prefix:       config.IPv6Prefix,
+		bans:             NewBans(config.Bans),
 		cleanupInterval:  config.CleanupInterval,
-		xffIndex:         config.XForwardedForIndex,
+		clientInfo:       config.ClientInfo,
+		messages:         config.Messages,
 		shutdownComplete: make(chan struct{}),
 	}
 
@@ -42,28 +106,45 @@ func New(ctx context.Context, config Config, _ any) *RateLimiter {
 	return limiter
 }
 
+// SetHosts sets where the limiter looks up hosts for error pages and metric
+// labels. It must be called before the limiter serves requests; until then
+// every host is unknown.
+func (rl *RateLimiter) SetHosts(hosts Hosts) {
+	rl.hosts = hosts
+}
+
 func (rl *RateLimiter) Limit(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip := rl.getClientIP(r)
+		addr, client, ok := rl.client(r)
 
-		key := ip + "|" + r.Host + "|" + r.URL.Path
+		if ok && rl.allowlisted(addr) {
+			next.ServeHTTP(w, r)
+			return
+		}
 
-		val, _ := rl.store.LoadOrStore(key,
-			rate.NewLimiter(
-				rate.Every(time.Minute/time.Duration(rl.requestsPerMin)),
-				rl.requestsPerMin,
-			),
-		)
+		if left, banned := rl.bans.Banned(client); banned {
+			slog.Debug("request from banned client", "client", client)
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(left)))
+			metrics.RecordRateLimitRejection(rl.hostLabel(r), "banned")
+
+			rl.reject(w, r)
+			return
+		}
 
-		limiter := val.(*rate.Limiter)
+		rule := rl.match(r)
+		res := rl.allow(r.Context(), rule.key(r, client), rule.Rate)
+		setHeaders(w.Header(), res)
 
-		if !limiter.Allow() {
+		if !res.Allowed {
 			slog.Debug("request rate-limited",
-				"ip", ip,
+				"client", client,
 				"path", r.URL.Path,
+				"rule", rule.Name,
 			)
+			metrics.RecordRateLimitRejection(rl.hostLabel(r), rule.Name)
+			rl.bans.Violation(client, "rate_limited")
 
-			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			rl.reject(w, r)
 			return
 		}
 
@@ -71,89 +152,139 @@ func (rl *RateLimiter) Limit(next http.Handler) http.Handler {
 	})
 }
 
-func (rl *RateLimiter) cleanupLoop(ctx context.Context) {
-	ticker := time.NewTicker(rl.cleanupInterval)
-	defer ticker.Stop()
+func (rl *RateLimiter) Violation(r *http.Request, reason string) {
+	_, client, _ := rl.client(r)
+	rl.bans.Violation(client, reason)
+}
 
-	for {
-		select {
-		case <-ticker.C:
-			rl.cleanup()
-		case <-ctx.Done():
-			slog.Info("rate limiter cleanup stopped")
-			close(rl.shutdownComplete)
-			return
+// Bans exposes the ban list, e.g. for the admin API.
+func (rl *RateLimiter) Bans() *Bans {
+	return rl.bans
+}
+
+// client returns the client's address and the key identifying it for
+// limiting and bans: the IP, or for IPv6 the enclosing prefix. ok is false
+// when no address could be determined; the key is then RemoteAddr verbatim.
+func (rl *RateLimiter) client(r *http.Request) (addr netip.Addr, key string, ok bool) {
+	addr, ok = rl.clientInfo.ClientAddr(r)
+	if !ok {
+		return addr, r.RemoteAddr, false
+	}
+	if addr.Is6() && rl.ipv6Prefix > 0 && rl.ipv6Prefix < 128 {
+		prefix, err := addr.Prefix(rl.ipv6Prefix)
+		if err == nil {
+			return addr, prefix.String(), true
 		}
 	}
+	return addr, addr.String(), true
 }
 
-func (rl *RateLimiter) cleanup() {
-	removed := 0
-	count := 0
+// setHeaders advertises the bucket state using the IETF RateLimit header
+// fields, plus Retry-After on rejections. Durations are rounded up to whole
+// seconds so clients never retry too early.
+func setHeaders(h http.Header, res Result) {
+	h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.ResetAfter)))
+	if !res.Allowed {
+		h.Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(res.RetryAfter))))
+	}
+}
 
-	rl.store.Range(func(key, value any) bool {
-		limiter := value.(*rate.Limiter)
-		count++
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
 
-		if limiter.Tokens() == float64(limiter.Burst()) {
-			rl.store.Delete(key)
-			removed++
-		}
-		return true
-	})
+// loginDir looks up the login directory of the request's host.
+func (rl *RateLimiter) loginDir(r *http.Request) (string, bool) {
+	if rl.hosts == nil {
+		return "", false
+	}
+	return rl.hosts.LoginDir(r.Host)
+}
 
-	slog.Debug(
-		"cleaning up rate limiters",
-		"total_before",
-		count,
-		"removed",
-		removed,
-	)
+// hostLabel is the request's host if it is served, for use as a metric label.
+func (rl *RateLimiter) hostLabel(r *http.Request) string {
+	if _, ok := rl.loginDir(r); ok {
+		return r.Host
+	}
+	return unknownHost
 }
 
-func (rl *RateLimiter) Shutdown() {
-	<-rl.shutdownComplete
+// reject writes the 429 response, using the host's error page if it has one.
+func (rl *RateLimiter) reject(w http.ResponseWriter, r *http.Request) {
+	if dir, ok := rl.loginDir(r); ok && dir != "" && rl.errorPage != "" {
+		path := filepath.Join(dir, rl.errorPage)
+		page, err := rl.pages.get(path)
+		if err == nil {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("Cache-Control", "no-store")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write(page)
+			return
+		}
+		slog.Debug("rate limit error page unavailable", "path", path, "error", err)
+	}
+
+	http.Error(w, rl.messages.Sprintf(r, "Rate limit exceeded"), http.StatusTooManyRequests)
 }
 
-func (rl *RateLimiter) getClientIP(r *http.Request) string {
-	// Priority 1: Check for CF-Connecting-IP (Cloudflare)
-	if cfIP := r.Header.Get("CF-Connecting-IP"); cfIP != "" {
-		return cfIP
+// match returns the first rule matching r, or the default rule.
+func (rl *RateLimiter) match(r *http.Request) *Rule {
+	for i := range rl.rules {
+		if rl.rules[i].matches(r) {
+			return &rl.rules[i]
+		}
 	}
+	return &rl.defaultRule
+}
 
-	// Priority 2: Check for X-Real-IP header (nginx/other proxies)
-	if xrip := r.Header.Get("X-Real-IP"); xrip != "" {
-		return xrip
+func (rl *RateLimiter) allowlisted(addr netip.Addr) bool {
+	for _, prefix := range rl.allowlist {
+		if prefix.Contains(addr) {
+			return true
+		}
 	}
+	return false
+}
 
-	// Priority 3: Check for X-Forwarded-For header (with configurable index)
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		ips := splitCSV(xff)
-		if len(ips) > 0 {
-			// Support positive indices (0 = first, 1 = second, etc.)
-			if rl.xffIndex >= 0 && rl.xffIndex < len(ips) {
-				return ips[rl.xffIndex]
-			}
-			// Support negative indices (-1 = last, -2 = second-to-last, etc.)
-			if rl.xffIndex < 0 && -rl.xffIndex <= len(ips) {
-				return ips[len(ips)+rl.xffIndex]
-			}
-			// Fallback to first IP if index out of bounds
-			return ips[0]
+// allow takes a token from the shared store, falling back to local buckets
+// when there is no store or it is failing.
+func (rl *RateLimiter) allow(ctx context.Context, key string, rate Rate) Result {
+	if rl.store != nil && time.Now().UnixNano() >= rl.storeDownUntil.Load() {
+		res, err := rl.store.Allow(ctx, key, rate)
+		if err == nil {
+			return res
 		}
+		slog.Warn("rate limit store unavailable, falling back to local limiting",
+			"retry_in", fallbackCooldown,
+			"error", err,
+		)
+		rl.storeDownUntil.Store(time.Now().Add(fallbackCooldown).UnixNano())
 	}
 
-	// Priority 4: Fall back to RemoteAddr
-	return r.RemoteAddr
+	// MemoryStore never fails.
+	res, _ := rl.local.Allow(ctx, key, rate)
+	return res
 }
 
-func splitCSV(s string) []string {
-	var result []string
-	for i, start := 0, 0; i <= len(s); i++ {
-		if i == len(s) || s[i] == ',' {
-			result = append(result, s[start:i])
-			start = i + 1
+func (rl *RateLimiter) cleanupLoop(ctx context.Context) {
+	ticker := time.NewTicker(rl.cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			rl.local.Cleanup()
+			rl.bans.cleanup()
+		case <-ctx.Done():
+			slog.Info("rate limiter cleanup stopped")
+			close(rl.shutdownComplete)
+			return
 		}
 	}
-	return result
+}
+
+func (rl *RateLimiter) Shutdown() {
+	<-rl.shutdownComplete
 }
@@ -0,0 +1,179 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iamolegga/lana/internal/clientinfo"
+)
+
+// flakyStore fails while down is set and otherwise allows everything.
+type flakyStore struct {
+	down  bool
+	calls int
+}
+
+func (s *flakyStore) Allow(_ context.Context, _ string, rate Rate) (Result, error) {
+	s.calls++
+	if s.down {
+		return Result{}, errors.New("connection refused")
+	}
+	return Result{Allowed: true, Limit: rate.Burst, Remaining: rate.Burst - 1}, nil
+}
+
+func newTestLimiter(t *testing.T, config Config, store Store) *RateLimiter {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	if config.CleanupInterval == 0 {
+		config.CleanupInterval = time.Minute
+	}
+	if config.ClientInfo == nil {
+		config.ClientInfo = clientinfo.New(clientinfo.Config{})
+	}
+	rl := New(ctx, config, store)
+	t.Cleanup(func() {
+		cancel()
+		rl.Shutdown()
+	})
+	return rl
+}
+
+func TestAllowFallsBackWhileStoreIsDown(t *testing.T) {
+	store := &flakyStore{down: true}
+	rl := newTestLimiter(t, Config{RequestsPerMinute: 60}, store)
+	rate := Rate{PerMinute: 60, Burst: 2}
+	ctx := context.Background()
+
+	// The failing call is answered by the local limiter, and so is everything
+	// until the cooldown ends: the store is not asked again.
+	for i, want := range []bool{true, true, false} {
+		if res := rl.allow(ctx, "client", rate); res.Allowed != want {
+			t.Errorf("request %d: allowed=%v, want %v", i, res.Allowed, want)
+		}
+	}
+	if store.calls != 1 {
+		t.Errorf("store called %d times during the cooldown, want 1", store.calls)
+	}
+	if left := time.Until(time.Unix(0, rl.storeDownUntil.Load())); left <= 0 || left > fallbackCooldown {
+		t.Errorf("store marked down for %v, want up to %v", left, fallbackCooldown)
+	}
+
+	// Once the cooldown is over, a failing store extends it.
+	rl.storeDownUntil.Store(time.Now().UnixNano())
+	rl.allow(ctx, "client", rate)
+	if store.calls != 2 {
+		t.Fatalf("store called %d times after the cooldown, want 2", store.calls)
+	}
+
+	// A recovered store is used again.
+	store.down = false
+	rl.storeDownUntil.Store(time.Now().UnixNano())
+	if res := rl.allow(ctx, "client", rate); !res.Allowed || store.calls != 3 {
+		t.Errorf("allowed=%v calls=%d after recovery, want the store's answer", res.Allowed, store.calls)
+	}
+}
+
+func TestLimitRejects(t *testing.T) {
+	rl := newTestLimiter(t, Config{
+		RequestsPerMinute: 60,
+		Rules: []Rule{{
+			Name:  "login",
+			Paths: []string{"/oauth/login/*"},
+			Rate:  Rate{PerMinute: 1, Burst: 1},
+			Key:   KeyIP,
+		}},
+	}, nil)
+	handler := rl.Limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	request := func(path string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.RemoteAddr = "203.0.113.7:5000"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := request("/oauth/login/google"); w.Code != http.StatusOK || w.Header().Get("RateLimit-Remaining") != "0" {
+		t.Fatalf("first request: %d, remaining %q", w.Code, w.Header().Get("RateLimit-Remaining"))
+	}
+	w := request("/oauth/login/x")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request: %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Retry-After = %q, want 60", got)
+	}
+	// Requests outside the rule use the default budget.
+	if w := request("/"); w.Code != http.StatusOK {
+		t.Errorf("unrelated request: %d", w.Code)
+	}
+}
+
+// testHosts serves the hosts in the map, with their login directories.
+type testHosts map[string]string
+
+func (h testHosts) LoginDir(host string) (string, bool) {
+	dir, ok := h[host]
+	return dir, ok
+}
+
+func TestRejectErrorPage(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "429.html"), []byte("<h1>slow down</h1>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	hosts := testHosts{"builtin.example": ""}
+	rl := newTestLimiter(t, Config{RequestsPerMinute: 60, ErrorPage: "429.html"}, nil)
+	rl.SetHosts(hosts)
+
+	reject := func(host string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Host = host
+		w := httptest.NewRecorder()
+		rl.reject(w, r)
+		return w
+	}
+
+	// A host added after the limiter was created gets its page.
+	hosts["runtime.example"] = dir
+	w := reject("runtime.example")
+	if w.Code != http.StatusTooManyRequests || w.Body.String() != "<h1>slow down</h1>" {
+		t.Errorf("served host: %d %q, want the error page", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	for _, host := range []string{"builtin.example", "unknown.example"} {
+		w := reject(host)
+		if w.Code != http.StatusTooManyRequests || !strings.Contains(w.Body.String(), "Rate limit exceeded") {
+			t.Errorf("%s: %d %q, want the plain-text body", host, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestHostLabel(t *testing.T) {
+	rl := newTestLimiter(t, Config{RequestsPerMinute: 60}, nil)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Host = "auth.example"
+	if got := rl.hostLabel(r); got != unknownHost {
+		t.Errorf("hostLabel before SetHosts = %q, want %q", got, unknownHost)
+	}
+
+	rl.SetHosts(testHosts{"auth.example": ""})
+	if got := rl.hostLabel(r); got != "auth.example" {
+		t.Errorf("hostLabel = %q, want the served host", got)
+	}
+	r.Host = "random-1234.example"
+	if got := rl.hostLabel(r); got != unknownHost {
+		t.Errorf("hostLabel = %q for a host that is not served, want %q", got, unknownHost)
+	}
+}
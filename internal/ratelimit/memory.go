@@ -0,0 +1,85 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// MemoryStore keeps buckets in process memory. Each replica enforces its own
+// limits, so it is only exact for single-instance deployments.
+type MemoryStore struct {
+	buckets sync.Map // key -> *rate.Limiter
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (m *MemoryStore) Allow(_ context.Context, key string, r Rate) (Result, error) {
+	val, _ := m.buckets.LoadOrStore(key,
+		rate.NewLimiter(rate.Every(r.interval()), r.Burst),
+	)
+	limiter := val.(*rate.Limiter)
+
+	now := time.Now()
+	reservation := limiter.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); !reservation.OK() || delay > 0 {
+		reservation.CancelAt(now)
+		tokens := limiter.TokensAt(now)
+		return Result{
+			Allowed:    false,
+			Limit:      r.Burst,
+			Remaining:  0,
+			RetryAfter: delay,
+			ResetAfter: refillTime(r, tokens),
+		}, nil
+	}
+
+	tokens := limiter.TokensAt(now)
+	return Result{
+		Allowed:    true,
+		Limit:      r.Burst,
+		Remaining:  int(math.Max(0, math.Floor(tokens))),
+		ResetAfter: refillTime(r, tokens),
+	}, nil
+}
+
+// Cleanup drops buckets that are full again, i.e. that carry no state worth
+// keeping.
+func (m *MemoryStore) Cleanup() {
+	removed := 0
+	count := 0
+
+	m.buckets.Range(func(key, value any) bool {
+		limiter := value.(*rate.Limiter)
+		count++
+
+		if limiter.Tokens() == float64(limiter.Burst()) {
+			m.buckets.Delete(key)
+			removed++
+		}
+		return true
+	})
+
+	slog.Debug(
+		"cleaning up rate limiters",
+		"total_before",
+		count,
+		"removed",
+		removed,
+	)
+}
+
+// refillTime returns how long a bucket holding tokens needs to become full.
+func refillTime(r Rate, tokens float64) time.Duration {
+	missing := float64(r.Burst) - tokens
+	if missing <= 0 {
+		return 0
+	}
+	return time.Duration(missing * float64(r.interval()))
+}
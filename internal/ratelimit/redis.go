@@ -0,0 +1,118 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// gcraScript implements the generic cell rate algorithm. The only state is
+// the bucket's theoretical arrival time (TAT), stored in seconds relative to
+// a fixed epoch so float precision is not wasted on the Unix timestamp.
+//
+// KEYS[1] - bucket key
+// ARGV[1] - burst
+// ARGV[2] - emission interval in seconds
+//
+// Returns {allowed, remaining, retry_after, reset_after}; durations are
+// strings because Redis truncates Lua numbers to integers.
+var gcraScript = redis.NewScript(`
+redis.replicate_commands()
+
+local key = KEYS[1]
+local burst = tonumber(ARGV[1])
+local emission_interval = tonumber(ARGV[2])
+local burst_offset = emission_interval * burst
+
+local now = redis.call("TIME")
+now = (now[1] - 1700000000) + now[2] / 1000000
+
+local tat = redis.call("GET", key)
+if not tat then
+  tat = now
+else
+  tat = tonumber(tat)
+end
+tat = math.max(tat, now)
+
+local new_tat = tat + emission_interval
+local diff = now - (new_tat - burst_offset)
+local remaining = diff / emission_interval
+
+if remaining < 0 then
+  return {0, 0, tostring(-diff), tostring(tat - now)}
+end
+
+local reset_after = new_tat - now
+redis.call("SET", key, tostring(new_tat), "EX", math.ceil(reset_after))
+return {1, math.floor(remaining), "0", tostring(reset_after)}
+`)
+
+// RedisStore keeps buckets in a Redis-protocol store so that every replica
+// shares the same limits.
+type RedisStore struct {
+	client  redis.Scripter
+	prefix  string
+	timeout time.Duration
+}
+
+// NewRedisStore returns a store that runs GCRA against client. Keys are
+// namespaced with prefix; each call is bounded by timeout.
+func NewRedisStore(client redis.Scripter, prefix string, timeout time.Duration) *RedisStore {
+	return &RedisStore{
+		client:  client,
+		prefix:  prefix,
+		timeout: timeout,
+	}
+}
+
+func (s *RedisStore) Allow(ctx context.Context, key string, r Rate) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	raw, err := gcraScript.Run(ctx, s.client,
+		[]string{s.prefix + key},
+		r.Burst,
+		r.interval().Seconds(),
+	).Slice()
+	if err != nil {
+		return Result{}, fmt.Errorf("run gcra script: %w", err)
+	}
+	if len(raw) != 4 {
+		return Result{}, fmt.Errorf("unexpected gcra reply: %v", raw)
+	}
+
+	allowed, _ := raw[0].(int64)
+	remaining, _ := raw[1].(int64)
+	retryAfter, err := parseSeconds(raw[2])
+	if err != nil {
+		return Result{}, err
+	}
+	resetAfter, err := parseSeconds(raw[3])
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{
+		Allowed:    allowed == 1,
+		Limit:      r.Burst,
+		Remaining:  int(remaining),
+		RetryAfter: retryAfter,
+		ResetAfter: resetAfter,
+	}, nil
+}
+
+func parseSeconds(v any) (time.Duration, error) {
+	s, ok := v.(string)
+	if !ok {
+		return 0, fmt.Errorf("unexpected gcra duration: %v", v)
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse gcra duration %q: %w", s, err)
+	}
+	return time.Duration(f * float64(time.Second)), nil
+}
@@ -0,0 +1,142 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestRedis starts an in-process Redis with its clock stopped at start
+// and returns it with a store using it.
+func newTestRedis(t *testing.T, start time.Time) (*miniredis.Miniredis, *RedisStore) {
+	t.Helper()
+	m := miniredis.RunT(t)
+	m.SetTime(start)
+	client := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return m, NewRedisStore(client, "test:", time.Second)
+}
+
+// near reports whether got is within a millisecond of want, as the script
+// works in float seconds.
+func near(got, want time.Duration) bool {
+	diff := got - want
+	return diff > -time.Millisecond && diff < time.Millisecond
+}
+
+func TestRedisStoreAllow(t *testing.T) {
+	start := time.Unix(1_800_000_000, 0)
+	m, store := newTestRedis(t, start)
+	rate := Rate{PerMinute: 60, Burst: 3} // one token per second
+	ctx := context.Background()
+
+	type step struct {
+		at         time.Duration // since start
+		allowed    bool
+		remaining  int
+		retryAfter time.Duration
+		resetAfter time.Duration
+		ttl        time.Duration // of the bucket key afterwards
+	}
+	steps := []step{
+		{at: 0, allowed: true, remaining: 2, resetAfter: time.Second, ttl: time.Second},
+		{at: 0, allowed: true, remaining: 1, resetAfter: 2 * time.Second, ttl: 2 * time.Second},
+		{at: 0, allowed: true, remaining: 0, resetAfter: 3 * time.Second, ttl: 3 * time.Second},
+		// The burst is used up; a rejection leaves the bucket alone.
+		{at: 0, allowed: false, retryAfter: time.Second, resetAfter: 3 * time.Second, ttl: 3 * time.Second},
+		{at: 250 * time.Millisecond, allowed: false, retryAfter: 750 * time.Millisecond, resetAfter: 2750 * time.Millisecond, ttl: 3 * time.Second},
+		// Half a token short of a second one, so nothing is left after it.
+		{at: 1500 * time.Millisecond, allowed: true, remaining: 0, resetAfter: 2500 * time.Millisecond, ttl: 3 * time.Second},
+		{at: 1500 * time.Millisecond, allowed: false, retryAfter: 500 * time.Millisecond, resetAfter: 2500 * time.Millisecond, ttl: 3 * time.Second},
+		// A full bucket again: the stored arrival time is in the past.
+		{at: 10 * time.Second, allowed: true, remaining: 2, resetAfter: time.Second, ttl: time.Second},
+	}
+
+	for i, s := range steps {
+		m.SetTime(start.Add(s.at))
+		res, err := store.Allow(ctx, "client", rate)
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if res.Allowed != s.allowed || res.Remaining != s.remaining || res.Limit != rate.Burst {
+			t.Errorf("step %d: allowed=%v remaining=%d limit=%d, want allowed=%v remaining=%d limit=%d",
+				i, res.Allowed, res.Remaining, res.Limit, s.allowed, s.remaining, rate.Burst)
+		}
+		if !near(res.RetryAfter, s.retryAfter) {
+			t.Errorf("step %d: RetryAfter = %v, want %v", i, res.RetryAfter, s.retryAfter)
+		}
+		if !near(res.ResetAfter, s.resetAfter) {
+			t.Errorf("step %d: ResetAfter = %v, want %v", i, res.ResetAfter, s.resetAfter)
+		}
+		// The TTL is the reset time rounded up to whole seconds.
+		if ttl := m.TTL("test:client"); ttl != s.ttl {
+			t.Errorf("step %d: TTL = %v, want %v", i, ttl, s.ttl)
+		}
+	}
+}
+
+func TestRedisStoreKeysAreIndependent(t *testing.T) {
+	m, store := newTestRedis(t, time.Unix(1_800_000_000, 0))
+	rate := Rate{PerMinute: 1, Burst: 1}
+	ctx := context.Background()
+
+	for _, key := range []string{"a", "b"} {
+		res, err := store.Allow(ctx, key, rate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.Allowed {
+			t.Errorf("first request for %q rejected", key)
+		}
+		if !m.Exists("test:" + key) {
+			t.Errorf("bucket for %q not stored under the prefix", key)
+		}
+	}
+
+	res, err := store.Allow(ctx, "a", rate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Allowed || !near(res.RetryAfter, time.Minute) {
+		t.Errorf("second request: allowed=%v RetryAfter=%v, want a rejection for a minute", res.Allowed, res.RetryAfter)
+	}
+}
+
+func TestRedisStoreExpiredKey(t *testing.T) {
+	start := time.Unix(1_800_000_000, 0)
+	m, store := newTestRedis(t, start)
+	rate := Rate{PerMinute: 30, Burst: 2}
+	ctx := context.Background()
+
+	for range 2 {
+		if _, err := store.Allow(ctx, "client", rate); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Once the bucket would be full again, the key is gone.
+	m.FastForward(4 * time.Second)
+	if m.Exists("test:client") {
+		t.Fatal("bucket outlived its reset time")
+	}
+
+	m.SetTime(start.Add(4 * time.Second))
+	res, err := store.Allow(ctx, "client", rate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Allowed || res.Remaining != 1 {
+		t.Errorf("allowed=%v remaining=%d, want a full bucket", res.Allowed, res.Remaining)
+	}
+}
+
+func TestRedisStoreError(t *testing.T) {
+	m, store := newTestRedis(t, time.Unix(1_800_000_000, 0))
+	m.Close()
+
+	if _, err := store.Allow(context.Background(), "client", Rate{PerMinute: 60, Burst: 1}); err == nil {
+		t.Fatal("Allow succeeded against a stopped server")
+	}
+}
@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/IGLOU-EU/go-wildcard"
+)
+
+// KeyBy selects which request attributes share a bucket.
+type KeyBy string
+
+const (
+	KeyIP         KeyBy = "ip"           // one bucket per client
+	KeyIPHost     KeyBy = "ip_host"      // one bucket per client and host
+	KeyIPHostPath KeyBy = "ip_host_path" // one bucket per client, host and path
+	KeyGlobal     KeyBy = "global"       // one bucket shared by everyone
+)
+
+// Rule is a rate limit policy. A request matches when its host, method and
+// path each match one of the rule's patterns; empty lists match anything.
+// Host and path patterns support `*` wildcards.
+type Rule struct {
+	Name    string
+	Hosts   []string
+	Methods []string
+	Paths   []string
+	Rate    Rate
+	Key     KeyBy
+}
+
+// defaultRuleName names the policy applied to requests no rule matches.
+const defaultRuleName = "default"
+
+func (rule *Rule) matches(r *http.Request) bool {
+	if len(rule.Methods) > 0 && !slices.Contains(rule.Methods, r.Method) {
+		return false
+	}
+	return matchAny(rule.Hosts, r.Host) && matchAny(rule.Paths, r.URL.Path)
+}
+
+// key returns the bucket key for a request from client. Keys are prefixed
+// with the rule name so that rules never share buckets.
+func (rule *Rule) key(r *http.Request, client string) string {
+	switch rule.Key {
+	case KeyIP:
+		return rule.Name + "|" + client
+	case KeyIPHostPath:
+		return rule.Name + "|" + client + "|" + r.Host + "|" + r.URL.Path
+	case KeyGlobal:
+		return rule.Name
+	default:
+		return rule.Name + "|" + client + "|" + r.Host
+	}
+}
+
+func matchAny(patterns []string, s string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if wildcard.Match(p, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Rate describes a token bucket: Burst tokens, refilled at PerMinute tokens
+// per minute.
+type Rate struct {
+	PerMinute int
+	Burst     int
+}
+
+// interval is the time it takes to refill a single token.
+func (r Rate) interval() time.Duration {
+	return time.Minute / time.Duration(r.PerMinute)
+}
+
+// Result is the outcome of taking one token from a bucket.
+type Result struct {
+	Allowed bool
+	// Limit is the bucket capacity (burst).
+	Limit int
+	// Remaining is the number of tokens left after this request.
+	Remaining int
+	// RetryAfter is how long to wait before the next request is allowed.
+	// Zero when Allowed is true.
+	RetryAfter time.Duration
+	// ResetAfter is how long until the bucket is full again.
+	ResetAfter time.Duration
+}
+
+// Store keeps token buckets. Implementations must be safe for concurrent use.
+type Store interface {
+	Allow(ctx context.Context, key string, rate Rate) (Result, error)
+}
@@ -0,0 +1,30 @@
+package redisconn
+
+import (
+	"crypto/tls"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/iamolegga/lana/internal/config"
+)
+
+// New builds a client for a Redis-protocol store. The client connects lazily,
+// so an unreachable store does not prevent startup; callers decide how to
+// degrade when commands fail.
+func New(cfg *config.Redis) *redis.Client {
+	opts := &redis.Options{
+		Addr:         cfg.Addr,
+		Username:     cfg.Username,
+		Password:     cfg.Password,
+		DB:           cfg.DB,
+		DialTimeout:  cfg.Timeout,
+		ReadTimeout:  cfg.Timeout,
+		WriteTimeout: cfg.Timeout,
+		// Fail fast: a slow store must not hold up requests.
+		MaxRetries: 1,
+	}
+	if cfg.TLS {
+		opts.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return redis.NewClient(opts)
+}
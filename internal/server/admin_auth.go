@@ -0,0 +1,240 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/IGLOU-EU/go-wildcard"
+	"github.com/coreos/go-oidc"
+	"github.com/iamolegga/lana/internal/config"
+)
+
+// Admin scopes. Write scopes do not imply read scopes.
+const (
+	scopeAssetsRead  = "assets:read"
+	scopeAssetsWrite = "assets:write"
+	scopeBansRead    = "bans:read"
+	scopeBansWrite   = "bans:write"
+	scopeConfigRead  = "config:read"
+	scopeHostsWrite  = "hosts:write"
+)
+
+var errUnauthenticated = errors.New("unauthenticated")
+
+// adminPrincipal is the authenticated caller of an admin endpoint.
+type adminPrincipal struct {
+	name   string
+	method string // "token", "client_cert", "jwt" or "none"
+	scopes []string
+	hosts  []string // patterns
+}
+
+// allowed reports whether the principal has scope, and access to host
+// unless it is empty.
+func (p *adminPrincipal) allowed(scope, host string) bool {
+	if !slices.Contains(p.scopes, scope) {
+		return false
+	}
+	return host == "" || p.hostAllowed(host)
+}
+
+// hostAllowed reports whether the principal has access to host.
+func (p *adminPrincipal) hostAllowed(host string) bool {
+	return slices.ContainsFunc(p.hosts, func(pattern string) bool {
+		return wildcard.Match(pattern, host)
+	})
+}
+
+type adminPrincipalKey struct{}
+
+// principalFrom returns the caller of an admin endpoint wrapped by guard.
+func principalFrom(r *http.Request) *adminPrincipal {
+	p, _ := r.Context().Value(adminPrincipalKey{}).(*adminPrincipal)
+	return p
+}
+
+type adminToken struct {
+	hash      [sha256.Size]byte
+	principal adminPrincipal
+}
+
+// adminAuth authenticates and authorizes admin requests and writes the audit
+// log.
+type adminAuth struct {
+	tokens   []adminToken
+	clients  map[string]adminPrincipal // key: certificate common name
+	verifier *oidc.IDTokenVerifier
+	jwt      *config.AdminJWT
+}
+
+func newAdminAuth(cfg config.Config) (*adminAuth, error) {
+	authCfg := cfg.Admin.Auth
+	a := &adminAuth{
+		clients: make(map[string]adminPrincipal, len(authCfg.Clients)),
+		jwt:     authCfg.JWT,
+	}
+
+	for _, t := range authCfg.Tokens {
+		a.tokens = append(a.tokens, adminToken{
+			hash: sha256.Sum256([]byte(t.Token)),
+			principal: adminPrincipal{
+				name:   t.Name,
+				method: "token",
+				scopes: t.Scopes,
+				hosts:  t.Hosts,
+			},
+		})
+	}
+
+	if len(authCfg.Clients) > 0 && cfg.Admin.TLS.ClientCAFile == "" {
+		return nil, fmt.Errorf("admin.auth.clients requires admin.tls.client_ca_file")
+	}
+	for _, c := range authCfg.Clients {
+		a.clients[c.CommonName] = adminPrincipal{
+			name:   c.CommonName,
+			method: "client_cert",
+			scopes: c.Scopes,
+			hosts:  c.Hosts,
+		}
+	}
+
+	if j := authCfg.JWT; j != nil {
+		keySet := oidc.NewRemoteKeySet(GetServerBaseContext(), j.JWKSURL)
+		a.verifier = oidc.NewVerifier(j.Issuer, keySet, &oidc.Config{
+			ClientID:             j.Audience,
+			SupportedSigningAlgs: []string{oidc.RS256, oidc.ES256},
+		})
+	}
+
+	if !a.enabled() {
+		slog.Warn("admin listener has no authentication configured; anyone who can reach it has full access")
+	}
+	return a, nil
+}
+
+func (a *adminAuth) enabled() bool {
+	return len(a.tokens) > 0 || len(a.clients) > 0 || a.verifier != nil
+}
+
+// authenticate identifies the caller by bearer token or, without one, by
+// client certificate.
+func (a *adminAuth) authenticate(r *http.Request) (*adminPrincipal, error) {
+	if !a.enabled() {
+		return &adminPrincipal{
+			name:   "anonymous",
+			method: "none",
+			scopes: []string{scopeAssetsRead, scopeAssetsWrite, scopeBansRead, scopeBansWrite, scopeConfigRead, scopeHostsWrite},
+			hosts:  []string{"*"},
+		}, nil
+	}
+
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return a.authenticateToken(r.Context(), strings.TrimSpace(token))
+	}
+
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		cn := r.TLS.PeerCertificates[0].Subject.CommonName
+		if p, ok := a.clients[cn]; ok {
+			return &p, nil
+		}
+		// A valid certificate without a grant may do nothing.
+		return &adminPrincipal{name: cn, method: "client_cert"}, nil
+	}
+
+	return nil, errUnauthenticated
+}
+
+func (a *adminAuth) authenticateToken(ctx context.Context, token string) (*adminPrincipal, error) {
+	hash := sha256.Sum256([]byte(token))
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare(hash[:], t.hash[:]) == 1 {
+			p := t.principal
+			return &p, nil
+		}
+	}
+
+	if a.verifier == nil {
+		return nil, errUnauthenticated
+	}
+	idToken, err := a.verifier.Verify(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errUnauthenticated, err)
+	}
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", errUnauthenticated, err)
+	}
+	return &adminPrincipal{
+		name:   idToken.Subject,
+		method: "jwt",
+		scopes: claimStrings(claims[a.jwt.ScopesClaim]),
+		hosts:  claimStrings(claims[a.jwt.HostsClaim]),
+	}, nil
+}
+
+// claimStrings reads a claim holding either a space-separated string or a
+// list of strings.
+func claimStrings(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		var out []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	default:
+		return nil
+	}
+}
+
+// guard wraps an admin endpoint: the caller must have scope and, for
+// endpoints with a {host} path segment, access to that host. Every request,
+// allowed or not, is written to the audit log.
+func (a *adminAuth) guard(action, scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		host := r.PathValue("host")
+		wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+
+		principal, err := a.authenticate(r)
+		switch {
+		case err != nil:
+			slog.Debug("admin authentication failed", "error", err)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="lana-admin"`)
+			http.Error(wrapped, "unauthorized", http.StatusUnauthorized)
+		case !principal.allowed(scope, host):
+			http.Error(wrapped, "forbidden", http.StatusForbidden)
+		default:
+			next.ServeHTTP(wrapped, r.WithContext(context.WithValue(r.Context(), adminPrincipalKey{}, principal)))
+		}
+
+		attrs := []slog.Attr{
+			slog.String("action", action),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("host", host),
+			slog.Int("status", wrapped.statusCode),
+			slog.String("remote_addr", r.RemoteAddr),
+			slog.Duration("duration", time.Since(start)),
+		}
+		if principal != nil {
+			attrs = append(attrs,
+				slog.String("principal", principal.name),
+				slog.String("auth", principal.method),
+			)
+		}
+		slog.LogAttrs(r.Context(), slog.LevelInfo, "admin audit", attrs...)
+	})
+}
@@ -2,36 +2,110 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 
+	"github.com/iamolegga/lana/internal/admin"
 	"github.com/iamolegga/lana/internal/config"
 	"github.com/iamolegga/lana/internal/logging"
+	"github.com/iamolegga/lana/internal/ratelimit"
 )
 
+type AdminConfig struct {
+	Config config.Config
+	// LoginDirs maps each configured host to its login directory on disk.
+	LoginDirs map[string]string
+	// Bans is the rate limiter's ban list.
+	Bans *ratelimit.Bans
+	// Hosts are the public server's hosts.
+	Hosts HostRegistry
+	// HostStore persists hosts created through the admin API. Nil disables
+	// runtime host management.
+	HostStore *admin.HostStore
+}
+
+// HostRegistry is the public server's set of hosts as seen by the admin
+// server; *Server implements it.
+type HostRegistry interface {
+	HostInfo() []admin.HostInfo
+	HostConfigs() map[string]config.HostConfig
+	SetHost(name string, hostConfig config.HostConfig, persist func() error) (bool, error)
+	RemoveHost(name string, persist func() error) error
+}
+
 // NewAdminServer builds a second http.Server that exposes operator endpoints
-// (currently: POST /admin/login-assets/{host}) on a dedicated port. It is
-// intended to be bound to a ClusterIP Service with no Ingress — access is
-// gated by Kubernetes RBAC (port-forward / exec), not by application-level
-// auth.
-//
-// loginDirs maps each configured host to its login directory on disk.
+// (login-asset uploads, file updates and versions, ban management, host
+// management, and introspection of hosts and config) on a dedicated port. Callers authenticate with bearer tokens, JWTs or client
+// certificates as configured under admin.auth; without any, access is gated
+// only by who can reach the port (e.g. Kubernetes RBAC on port-forward).
 //
 // Returns nil when the admin feature is disabled.
-func NewAdminServer(cfg config.Config, loginDirs map[string]string) *http.Server {
+func NewAdminServer(acfg AdminConfig) (*http.Server, error) {
+	cfg := acfg.Config
 	if !cfg.Admin.Enabled {
-		return nil
+		return nil, nil
+	}
+
+	auth, err := newAdminAuth(cfg)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := adminTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	assets := make(map[string]*admin.Versions, len(acfg.LoginDirs))
+	for host, loginDir := range acfg.LoginDirs {
+		assets[host] = admin.NewVersions(loginDir, cfg.Admin.AssetVersions)
+	}
+
+	limits := uploadLimits{
+		maxBytes: cfg.Admin.Upload.MaxBytes,
+		extract: admin.Limits{
+			MaxEntries:          cfg.Admin.Upload.MaxEntries,
+			MaxExtractedBytes:   cfg.Admin.Upload.MaxExtractedBytes,
+			MaxCompressionRatio: cfg.Admin.Upload.MaxCompressionRatio,
+		},
 	}
 
 	mux := http.NewServeMux()
 	mux.Handle(
-		"POST /admin/login-assets/{host}",
-		handlerAdminLoginAssetsUpload(loginDirs),
+		"POST "+admin.RouteLoginAssets,
+		auth.guard("assets.upload", scopeAssetsWrite, handlerAdminLoginAssetsUpload(assets, limits)),
+	)
+	mux.Handle(
+		"PUT "+admin.RouteLoginAssetFile,
+		auth.guard("assets.put_file", scopeAssetsWrite, handlerAdminLoginAssetFilePut(assets, limits)),
+	)
+	mux.Handle(
+		"GET "+admin.RouteVersions,
+		auth.guard("versions.list", scopeAssetsRead, handlerAdminVersionsList(assets)),
+	)
+	mux.Handle(
+		"POST "+admin.RouteVersionActivate,
+		auth.guard("versions.activate", scopeAssetsWrite, handlerAdminVersionActivate(assets)),
+	)
+	mux.Handle(
+		"DELETE "+admin.RouteVersion,
+		auth.guard("versions.delete", scopeAssetsWrite, handlerAdminVersionDelete(assets)),
 	)
+	mux.Handle("GET "+admin.RouteHosts, auth.guard("hosts.list", scopeConfigRead, handlerAdminHostsList(acfg.Hosts)))
+	mux.Handle("GET "+admin.RouteHost, auth.guard("hosts.get", scopeConfigRead, handlerAdminHostGet(acfg.Hosts, assets)))
+	if acfg.HostStore != nil {
+		mux.Handle("PUT "+admin.RouteHost, auth.guard("hosts.put", scopeHostsWrite, handlerAdminHostPut(acfg.Hosts, acfg.HostStore)))
+		mux.Handle("DELETE "+admin.RouteHost, auth.guard("hosts.delete", scopeHostsWrite, handlerAdminHostDelete(acfg.Hosts, acfg.HostStore)))
+	}
+	mux.Handle("GET "+admin.RouteConfig, auth.guard("config.get", scopeConfigRead, handlerAdminConfig(cfg, acfg.Hosts)))
+	mux.Handle("GET "+admin.RouteBans, auth.guard("bans.list", scopeBansRead, handlerAdminBansList(acfg.Bans)))
+	mux.Handle("DELETE "+admin.RouteBan, auth.guard("bans.clear", scopeBansWrite, handlerAdminBansClear(acfg.Bans)))
 
 	var handler http.Handler = mux
 	handler = logging.Middleware(handler)
@@ -44,20 +118,88 @@ func NewAdminServer(cfg config.Config, loginDirs map[string]string) *http.Server
 		ReadTimeout:  0, // uploads can be large; no read timeout for the admin port
 		WriteTimeout: 0,
 		IdleTimeout:  60 * time.Second,
+		TLSConfig:    tlsConfig,
 		BaseContext: func(_ net.Listener) context.Context {
 			return GetServerBaseContext()
 		},
+	}, nil
+}
+
+// adminTLSConfig returns the admin listener's TLS configuration, or nil to
+// serve plain HTTP. With a client CA, certificates are verified when sent
+// but not required, so bearer tokens keep working.
+func adminTLSConfig(cfg config.Config) (*tls.Config, error) {
+	tlsCfg := cfg.Admin.TLS
+	if tlsCfg.CertFile == "" {
+		return nil, nil
 	}
+
+	cert, err := tls.LoadX509KeyPair(tlsCfg.CertFile, tlsCfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load admin TLS certificate: %w", err)
+	}
+	c := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if tlsCfg.ClientCAFile != "" {
+		pemData, err := os.ReadFile(tlsCfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read admin client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pemData) {
+			return nil, fmt.Errorf("no certificates found in admin client CA file %s", tlsCfg.ClientCAFile)
+		}
+		c.ClientCAs = pool
+		c.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return c, nil
 }
 
 // classifyAdminPath maps a request on the admin listener to a bounded
-// `path` label value. The only registered route is the login-asset upload;
-// anything else is bucketed as "unknown" to keep label cardinality bounded.
+// `path` label value: the route template, since host names, file paths,
+// version numbers and client addresses are unbounded. Ban management is
+// collapsed into one label. Anything else is bucketed as "unknown". It runs
+// before authentication, so nothing taken from the request may leak into
+// the label.
 func classifyAdminPath(r *http.Request) string {
-	if strings.HasPrefix(r.URL.Path, "/admin/login-assets/") {
-		return r.URL.Path
+	p := r.URL.Path
+	switch {
+	case strings.HasPrefix(p, "/admin/login-assets/"):
+		_, rest, _ := strings.Cut(strings.TrimPrefix(p, "/admin/login-assets/"), "/")
+		return classifyLoginAssetsPath(rest)
+	case p == admin.RouteBans, strings.HasPrefix(p, "/admin/bans/"):
+		return admin.RouteBans
+	case p == admin.RouteHosts, p == admin.RouteConfig:
+		return p
+	case strings.HasPrefix(p, "/admin/hosts/") && !strings.Contains(strings.TrimPrefix(p, "/admin/hosts/"), "/"):
+		return admin.RouteHost
+	default:
+		return "unknown"
+	}
+}
+
+// classifyLoginAssetsPath maps the part of a login-assets path after the
+// host to its route template.
+func classifyLoginAssetsPath(rest string) string {
+	switch segments := strings.Split(rest, "/"); {
+	case rest == "":
+		return admin.RouteLoginAssets
+	case segments[0] == "files" && len(segments) > 1:
+		return admin.RouteLoginAssetFile
+	case segments[0] != "versions":
+		return "unknown"
+	case len(segments) == 1:
+		return admin.RouteVersions
+	case len(segments) == 2:
+		return admin.RouteVersion
+	case len(segments) == 3 && segments[2] == "activate":
+		return admin.RouteVersionActivate
+	default:
+		return "unknown"
 	}
-	return "unknown"
 }
 
 // StartAdmin blocks on ListenAndServe for the given admin server. Returns
@@ -66,6 +208,11 @@ func StartAdmin(server *http.Server) error {
 	if server == nil {
 		return nil
 	}
+	if server.TLSConfig != nil {
+		slog.Info("starting admin server", "addr", server.Addr, "tls", true)
+		// The certificate is already in TLSConfig.
+		return server.ListenAndServeTLS("", "")
+	}
 	slog.Info("starting admin server", "addr", server.Addr)
 	return server.ListenAndServe()
 }
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClassifyAdminPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/admin/login-assets/auth.example.com", "/admin/login-assets/{host}"},
+		{"/admin/login-assets/random-1234", "/admin/login-assets/{host}"},
+		{"/admin/login-assets/auth.example.com/files/css/app.css", "/admin/login-assets/{host}/files/{path...}"},
+		{"/admin/login-assets/auth.example.com/files", "unknown"},
+		{"/admin/login-assets/auth.example.com/versions", "/admin/login-assets/{host}/versions"},
+		{"/admin/login-assets/auth.example.com/versions/12", "/admin/login-assets/{host}/versions/{version}"},
+		{"/admin/login-assets/auth.example.com/versions/12/activate", "/admin/login-assets/{host}/versions/{version}/activate"},
+		{"/admin/login-assets/auth.example.com/versions/12/other", "unknown"},
+		{"/admin/login-assets/auth.example.com/anything", "unknown"},
+		{"/admin/hosts", "/admin/hosts"},
+		{"/admin/hosts/auth.example.com", "/admin/hosts/{host}"},
+		{"/admin/hosts/random-1234", "/admin/hosts/{host}"},
+		{"/admin/hosts/a/b", "unknown"},
+		{"/admin/config", "/admin/config"},
+		{"/admin/bans", "/admin/bans"},
+		{"/admin/bans/203.0.113.7", "/admin/bans"},
+		{"/admin/other", "unknown"},
+		{"/", "unknown"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if got := classifyAdminPath(r); got != tt.want {
+			t.Errorf("classifyAdminPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IGLOU-EU/go-wildcard"
+	"github.com/iamolegga/lana/internal/config"
+)
+
+// defaultCacheControl applies to assets no cache_control rule matches. It
+// lets browsers keep assets but makes them revalidate with the ETag, since
+// uploads replace the login directory wholesale.
+const defaultCacheControl = "no-cache"
+
+// encodings are the precompressed variants looked for next to an asset, in
+// order of preference.
+var encodings = []struct {
+	name   string // Content-Encoding token
+	suffix string // file name suffix
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+type cachedETag struct {
+	modTime time.Time
+	size    int64
+	etag    string
+}
+
+// etagCache remembers the content hash of asset files until their size or
+// modification time changes.
+type etagCache struct {
+	mu    sync.Mutex
+	etags map[string]cachedETag // key: file path
+}
+
+func newETagCache() *etagCache {
+	return &etagCache{etags: make(map[string]cachedETag)}
+}
+
+// get returns a strong ETag for the file at path, whose stat is info.
+func (c *etagCache) get(path string, info fs.FileInfo) (string, error) {
+	c.mu.Lock()
+	cached, ok := c.etags[path]
+	c.mu.Unlock()
+	if ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.etag, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("could not hash %s: %w", path, err)
+	}
+	etag := `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+
+	c.mu.Lock()
+	c.etags[path] = cachedETag{modTime: info.ModTime(), size: info.Size(), etag: etag}
+	c.mu.Unlock()
+	return etag, nil
+}
+
+// serveAsset serves name (a clean, slash-separated path) from the host's
+// login directory, preferring a precompressed variant the client accepts.
+// Conditional and range requests are handled by http.ServeContent.
+func (s *Server) serveAsset(w http.ResponseWriter, r *http.Request, host *hostData, name string) {
+	filePath := filepath.Join(host.loginDir, filepath.FromSlash(name))
+
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	servePath, encoding := filePath, ""
+	for _, enc := range encodings {
+		if !acceptsEncoding(r, enc.name) {
+			continue
+		}
+		if info, err := os.Stat(filePath + enc.suffix); err == nil && info.Mode().IsRegular() {
+			servePath, encoding = filePath+enc.suffix, enc.name
+			break
+		}
+	}
+
+	f, err := os.Open(servePath)
+	if err != nil {
+		slog.Warn("failed to serve", "path", servePath, "error", err)
+		s.notFound(w, r, host)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		slog.Warn("failed to stat asset", "path", servePath, "error", err)
+		s.notFound(w, r, host)
+		return
+	}
+
+	etag, err := s.etags.get(servePath, info)
+	if err != nil {
+		slog.Error("failed to compute ETag", "path", servePath, "error", err)
+		http.Error(w, s.i18n.Sprintf(r, "Internal server error"), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", cacheControl(host.cacheControl, "/"+name))
+	if encoding != "" {
+		w.Header().Set("Content-Encoding", encoding)
+		// Sniffing would look at compressed bytes, so go by extension only.
+		contentType := mime.TypeByExtension(path.Ext(name))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		w.Header().Set("Content-Type", contentType)
+	}
+
+	slog.Debug("serving file", "path", servePath)
+	http.ServeContent(w, r, path.Base(name), info.ModTime(), f)
+}
+
+// cacheControl returns the value of the first rule matching urlPath.
+func cacheControl(rules []config.CacheControlRule, urlPath string) string {
+	for _, rule := range rules {
+		if wildcard.Match(rule.Path, urlPath) {
+			return rule.Value
+		}
+	}
+	return defaultCacheControl
+}
+
+// acceptsEncoding reports whether the request's Accept-Encoding allows
+// coding, i.e. lists it (or `*`) without q=0.
+func acceptsEncoding(r *http.Request, coding string) bool {
+	for _, header := range r.Header.Values("Accept-Encoding") {
+		for _, part := range strings.Split(header, ",") {
+			token, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+			token = strings.TrimSpace(token)
+			if !strings.EqualFold(token, coding) && token != "*" {
+				continue
+			}
+			if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/IGLOU-EU/go-wildcard"
+)
+
+// errorPageName is the file in a host's login_dir used to render errors.
+const errorPageName = "error.html"
+
+// defaultErrorPage renders errors for hosts without their own error.html.
+var defaultErrorPage = template.Must(template.ParseFS(webFS, "web/error.html"))
+
+// errorPageData is what error pages are rendered with.
+type errorPageData struct {
+	pageData
+	Status     int
+	StatusText string
+	Code       string // OAuth 2.0 error code, e.g. "access_denied"
+	Message    string
+	LoginURL   string // login page, keeping the redirect when it is known
+}
+
+// renderError reports a failed login to the user. When the host opts in
+// with error_redirect and redirect is an allowed client URL, the user is sent
+// back there with error and error_description query parameters; otherwise
+// the host's error page is rendered. The message is key translated into the
+// request's locale and formatted with args. host may be nil for unknown hosts.
+func (s *Server) renderError(
+	w http.ResponseWriter,
+	r *http.Request,
+	host *hostData,
+	redirect string,
+	status int,
+	code string,
+	key string,
+	args ...any,
+) {
+	page := s.newPageData(r, host)
+	message := page.T(key, args...)
+
+	if host != nil && host.errorRedirect && redirect != "" && host.redirectAllowed(redirect) {
+		target, err := url.Parse(redirect)
+		if err == nil {
+			q := target.Query()
+			q.Set("error", code)
+			q.Set("error_description", message)
+			target.RawQuery = q.Encode()
+			http.Redirect(w, r, target.String(), http.StatusSeeOther)
+			return
+		}
+		slog.Debug("failed to parse redirect URL for error", "error", err)
+	}
+
+	data := errorPageData{
+		pageData:   page,
+		Status:     status,
+		StatusText: page.T(http.StatusText(status)),
+		Code:       code,
+		Message:    message,
+		LoginURL:   "/",
+	}
+	if redirect != "" {
+		data.LoginURL = "/?redirect=" + url.QueryEscape(redirect)
+	}
+
+	tmpl := defaultErrorPage
+	if host != nil && host.template {
+		tmpl = s.errorTemplate(host)
+	} else if host != nil {
+		if page, ok := staticErrorPage(host); ok {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("Cache-Control", "no-store")
+			w.WriteHeader(status)
+			_, _ = w.Write(page)
+			return
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		slog.Error("failed to render error page", "template", tmpl.Name(), "error", err)
+		http.Error(w, message, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_, _ = buf.WriteTo(w)
+}
+
+// staticErrorPage returns the host's error.html as is, for hosts whose
+// login_dir is not rendered as templates. ok is false when there is none.
+func staticErrorPage(host *hostData) (page []byte, ok bool) {
+	if host.loginDir == "" {
+		return nil, false
+	}
+
+	path := filepath.Join(host.loginDir, errorPageName)
+	page, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			slog.Error("failed to read error page", "path", path, "error", err)
+		}
+		return nil, false
+	}
+	return page, true
+}
+
+// errorTemplate returns the host's error.html, or the built-in error page
+// when the host has none or it cannot be parsed. Only hosts with template
+// enabled have their error.html parsed as a template.
+func (s *Server) errorTemplate(host *hostData) *template.Template {
+	if host.loginDir == "" {
+		return defaultErrorPage
+	}
+
+	path := filepath.Join(host.loginDir, errorPageName)
+	tmpl, err := s.templates.get(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			slog.Error("failed to load error page template", "path", path, "error", err)
+		}
+		return defaultErrorPage
+	}
+	return tmpl
+}
+
+// redirectAllowed reports whether redirectURL matches one of the host's
+// allowed redirect URL patterns.
+func (h *hostData) redirectAllowed(redirectURL string) bool {
+	for _, pattern := range h.allowedRedirectURLs {
+		if wildcard.Match(pattern, redirectURL) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/iamolegga/lana/internal/i18n"
+)
+
+func newErrorPageServer(t *testing.T) *Server {
+	t.Helper()
+	messages, err := i18n.New(i18n.Config{DefaultLocale: "en"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Server{i18n: messages, templates: newTemplateCache()}
+}
+
+func TestRenderErrorPage(t *testing.T) {
+	// Braces that are not template actions, as in inline scripts or styles.
+	const page = `<h1>Oops</h1><script>const t = "{{ not a template }}";</script>{{.Message}}`
+
+	withPage := t.TempDir()
+	if err := os.WriteFile(filepath.Join(withPage, errorPageName), []byte(page), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	withTemplate := t.TempDir()
+	if err := os.WriteFile(filepath.Join(withTemplate, errorPageName), []byte(`<p>{{.Status}} {{.Code}}: {{.Message}}</p>`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		host *hostData
+		want string // body, or a substring of the built-in page
+		full bool   // want is the whole body
+	}{
+		{
+			name: "unknown host",
+			want: "State mismatch",
+		},
+		{
+			name: "built-in login page",
+			host: &hostData{},
+			want: "State mismatch",
+		},
+		{
+			name: "static error.html is served as is",
+			host: &hostData{loginDir: withPage},
+			want: page,
+			full: true,
+		},
+		{
+			name: "static login_dir without error.html",
+			host: &hostData{loginDir: t.TempDir()},
+			want: "State mismatch",
+		},
+		{
+			name: "templated error.html",
+			host: &hostData{loginDir: withTemplate, template: true},
+			want: "<p>400 invalid_request: State mismatch</p>",
+			full: true,
+		},
+		{
+			name: "templated login_dir with an unparsable error.html",
+			host: &hostData{loginDir: withPage, template: true},
+			want: "State mismatch",
+		},
+	}
+
+	s := newErrorPageServer(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/oauth/callback/google", nil)
+			w := httptest.NewRecorder()
+			s.renderError(w, r, tt.host, "", http.StatusBadRequest, "invalid_request", "State mismatch")
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400", w.Code)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			body := w.Body.String()
+			if tt.full && body != tt.want {
+				t.Errorf("body = %q, want %q", body, tt.want)
+			}
+			if !tt.full && (!strings.Contains(body, tt.want) || strings.Contains(body, "Oops")) {
+				t.Errorf("body = %q, want the built-in page", body)
+			}
+		})
+	}
+}
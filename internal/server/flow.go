@@ -0,0 +1,104 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/iamolegga/lana/internal/statestore"
+)
+
+var (
+	errMissingStateCookie = errors.New("missing state cookie")
+	errInvalidStateCookie = errors.New("invalid state cookie")
+	errStateMismatch      = errors.New("state mismatch")
+	errStateExpired       = errors.New("state expired")
+	errStateConsumed      = errors.New("state already used")
+)
+
+// saveFlow persists a login flow for its callback. Without a state store the
+// whole flow travels in the encrypted state cookie. With a store the state
+// parameter is the handle to the stored flow; the cookie, if binding is
+// enabled, only proves that the callback comes from the browser that
+// started the login.
+func (s *Server) saveFlow(w http.ResponseWriter, r *http.Request, flow flowState, providerName string) error {
+	cookieData := flow
+
+	if s.stateStore != nil {
+		data, err := json.Marshal(flow)
+		if err != nil {
+			return fmt.Errorf("could not marshal state data: %w", err)
+		}
+		if err := s.stateStore.Put(r.Context(), flow.State, data, s.stateTTL); err != nil {
+			return fmt.Errorf("could not store state: %w", err)
+		}
+		if !s.bindCookie {
+			return nil
+		}
+		cookieData = flowState{State: flow.State, CreatedAt: flow.CreatedAt}
+	}
+
+	encrypted, err := s.stateKeys.encrypt(cookieData)
+	if err != nil {
+		return fmt.Errorf("could not encrypt state data: %w", err)
+	}
+
+	s.pruneStateCookies(w, r)
+	s.setStateCookie(w, r, flow.State, encrypted, providerName)
+	return nil
+}
+
+// loadFlow returns the flow for the state received in a callback and marks
+// it as consumed, so a callback can't be replayed. cookieName is the flow's
+// state cookie, or empty when no cookie is involved.
+func (s *Server) loadFlow(r *http.Request, state string) (flow flowState, cookieName string, err error) {
+	if s.stateStore == nil || s.bindCookie {
+		cookie, err := r.Cookie(s.stateCookieName(state))
+		if err != nil {
+			return flowState{}, "", errMissingStateCookie
+		}
+		flow, err = s.stateKeys.decrypt(cookie.Value)
+		if err != nil {
+			return flowState{}, "", fmt.Errorf("%w: %w", errInvalidStateCookie, err)
+		}
+		if flow.State != state {
+			return flowState{}, "", errStateMismatch
+		}
+		cookieName = cookie.Name
+	}
+
+	if s.stateStore == nil {
+		if time.Since(time.Unix(flow.CreatedAt, 0)) > s.stateTTL {
+			return flowState{}, cookieName, errStateExpired
+		}
+		// The cookie stays valid until it expires; remember it was used.
+		claimed, err := s.consumed.Claim(r.Context(), "consumed:"+state, s.stateTTL)
+		if err != nil {
+			return flowState{}, cookieName, fmt.Errorf("could not mark state as consumed: %w", err)
+		}
+		if !claimed {
+			return flowState{}, cookieName, errStateConsumed
+		}
+		return flow, cookieName, nil
+	}
+
+	data, err := s.stateStore.Take(r.Context(), state)
+	if err != nil {
+		// statestore.ErrNotFound: expired, forged or replayed.
+		return flowState{}, cookieName, err
+	}
+	if err := json.Unmarshal(data, &flow); err != nil {
+		return flowState{}, cookieName, fmt.Errorf("could not unmarshal state data: %w", err)
+	}
+	if flow.State != state {
+		return flowState{}, cookieName, errStateMismatch
+	}
+	return flow, cookieName, nil
+}
+
+// isFlowNotFound reports whether err means the stored flow does not exist.
+func isFlowNotFound(err error) bool {
+	return errors.Is(err, statestore.ErrNotFound)
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/iamolegga/lana/internal/admin"
+	"github.com/iamolegga/lana/internal/ratelimit"
+)
+
+func handlerAdminBansList(bans *ratelimit.Bans) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list := []ratelimit.Ban{}
+		if bans != nil {
+			list = bans.List()
+		}
+		if err := writeJSON(w, list); err != nil {
+			slog.Error("failed to write bans response", "error", err)
+		}
+	}
+}
+
+func handlerAdminBansClear(bans *ratelimit.Bans) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		client := r.PathValue("client")
+		if bans == nil || !bans.Clear(client) {
+			http.Error(w, "client is not banned", http.StatusNotFound)
+			return
+		}
+
+		slog.Info("ban cleared", "client", client)
+		if err := writeJSON(w, admin.StatusResponse{Status: "ok"}); err != nil {
+			slog.Error("failed to write ban response", "error", err)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/iamolegga/lana/internal/admin"
+	"github.com/iamolegga/lana/internal/config"
+	"go.yaml.in/yaml/v3"
+)
+
+// maxHostConfigBytes bounds host configuration request bodies.
+const maxHostConfigBytes = 1 << 20
+
+// handlerAdminHostPut creates or replaces a host from a YAML or JSON body
+// with the fields of a hosts.<hostname> config entry. login_dir and
+// private_key_file fields name files on the server and cannot be set; the
+// host gets a generated signing key and the built-in login page.
+func handlerAdminHostPut(hosts HostRegistry, store *admin.HostStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("host")
+		if err := config.ValidateHostName(name); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var hostConfig config.HostConfig
+		dec := yaml.NewDecoder(http.MaxBytesReader(w, r.Body, maxHostConfigBytes))
+		dec.KnownFields(true)
+		if err := dec.Decode(&hostConfig); err != nil {
+			http.Error(w, "invalid host config: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if setsServerFiles(hostConfig) {
+			http.Error(w, "login_dir and private_key_file cannot be set through the admin API", http.StatusBadRequest)
+			return
+		}
+
+		if existing, ok := hostInfo(hosts, name); ok && existing.Source == hostSourceConfig {
+			http.Error(w, ErrHostInConfigFile.Error(), http.StatusConflict)
+			return
+		}
+
+		keyFile, generated, err := store.SigningKey(name)
+		if err != nil {
+			slog.Error("failed to create signing key", "host", name, "error", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		hostConfig.JWT.PrivateKeyFile = keyFile
+
+		created, err := hosts.SetHost(name, hostConfig, func() error {
+			return store.Save(name, hostConfig)
+		})
+		if err != nil && generated {
+			// Do not leave a key behind for a host that was not created.
+			if err := store.Delete(name); err != nil {
+				slog.Warn("failed to remove unused signing key", "host", name, "error", err)
+			}
+		}
+		switch {
+		case errors.Is(err, ErrInvalidHost):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case errors.Is(err, ErrHostInConfigFile):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			slog.Error("failed to store host", "host", name, "error", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		info, _ := hostInfo(hosts, name)
+		if created {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+		}
+		if err := writeJSON(w, info); err != nil {
+			slog.Error("failed to write host response", "error", err)
+		}
+	}
+}
+
+// handlerAdminHostDelete removes a host created through the admin API.
+func handlerAdminHostDelete(hosts HostRegistry, store *admin.HostStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("host")
+		err := hosts.RemoveHost(name, func() error {
+			return store.Delete(name)
+		})
+		switch {
+		case errors.Is(err, ErrHostNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.Is(err, ErrHostInConfigFile):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			slog.Error("failed to delete stored host", "host", name, "error", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := writeJSON(w, admin.StatusResponse{Status: "ok"}); err != nil {
+			slog.Error("failed to write host response", "error", err)
+		}
+	}
+}
+
+func setsServerFiles(hostConfig config.HostConfig) bool {
+	if hostConfig.LoginDir != "" || hostConfig.JWT.PrivateKeyFile != "" {
+		return true
+	}
+	for _, provider := range hostConfig.Providers {
+		if provider.PrivateKeyFile != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/iamolegga/lana/internal/admin"
+	"github.com/iamolegga/lana/internal/config"
+	"go.yaml.in/yaml/v3"
+)
+
+// handlerAdminHostsList lists the hosts the caller has access to.
+func handlerAdminHostsList(hosts HostRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal := principalFrom(r)
+		list := []admin.HostInfo{}
+		for _, host := range hosts.HostInfo() {
+			if principal.hostAllowed(host.Name) {
+				list = append(list, host)
+			}
+		}
+		if err := writeJSON(w, list); err != nil {
+			slog.Error("failed to write hosts response", "error", err)
+		}
+	}
+}
+
+// handlerAdminHostGet describes one host, including the login assets being
+// served.
+func handlerAdminHostGet(hosts HostRegistry, assets map[string]*admin.Versions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("host")
+		host, ok := hostInfo(hosts, name)
+		if !ok {
+			http.Error(w, "unknown host", http.StatusNotFound)
+			return
+		}
+
+		if versions, ok := assets[name]; ok {
+			active, err := versions.Active()
+			if err != nil {
+				slog.Error("failed to read active login asset version", "host", name, "error", err)
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+			files, err := versions.Checksums()
+			if err != nil {
+				slog.Error("failed to checksum login assets", "host", name, "error", err)
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+			host.Assets = &admin.AssetsInfo{ActiveVersion: active, Files: files}
+		}
+
+		if err := writeJSON(w, host); err != nil {
+			slog.Error("failed to write host response", "error", err)
+		}
+	}
+}
+
+// handlerAdminConfig returns the effective configuration as YAML, including
+// hosts created at runtime, with secrets redacted and only the hosts the
+// caller has access to.
+func handlerAdminConfig(cfg config.Config, hosts HostRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal := principalFrom(r)
+		effective := cfg
+		effective.Hosts = hosts.HostConfigs()
+		redacted := config.Redacted(effective)
+		for name := range redacted.Hosts {
+			if !principal.hostAllowed(name) {
+				delete(redacted.Hosts, name)
+			}
+		}
+
+		out, err := yaml.Marshal(redacted)
+		if err != nil {
+			slog.Error("failed to encode config", "error", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/yaml")
+		_, _ = w.Write(out)
+	}
+}
+
+func hostInfo(hosts HostRegistry, name string) (*admin.HostInfo, bool) {
+	for _, h := range hosts.HostInfo() {
+		if h.Name == name {
+			return &h, true
+		}
+	}
+	return nil, false
+}
@@ -1,121 +1,203 @@
 package server
 
 import (
-	"crypto/rand"
-	"encoding/hex"
 	"errors"
 	"io"
 	"log/slog"
 	"net/http"
 	"os"
-	"path/filepath"
 	"time"
 
 	"github.com/iamolegga/lana/internal/admin"
 )
 
-func handlerAdminLoginAssetsUpload(loginDirs map[string]string) http.HandlerFunc {
+// uploadLimits bound login asset uploads.
+type uploadLimits struct {
+	maxBytes int64 // request body size
+	extract  admin.Limits
+}
+
+func handlerAdminLoginAssetsUpload(assets map[string]*admin.Versions, limits uploadLimits) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		host := r.PathValue("host")
-		raw, exists := loginDirs[host]
+		versions, exists := assets[host]
 		if !exists {
 			http.Error(w, "unknown host", http.StatusNotFound)
 			return
 		}
 
 		start := time.Now()
-		// filepath.Clean strips any trailing slash so filepath.Dir returns the
-		// true parent, not the directory itself.
-		loginDir := filepath.Clean(raw)
-		parent := filepath.Dir(loginDir)
 
-		suffix, err := randomSuffix()
+		tmpDir, err := versions.StagingDir()
 		if err != nil {
-			slog.Error("failed to generate temp suffix", "host", host, "error", err)
+			slog.Error("failed to create staging dir", "host", host, "error", err)
 			http.Error(w, "internal error", http.StatusInternalServerError)
 			return
 		}
-		tmpZipPath := filepath.Join(parent, ".tmp-zip-"+suffix)
-		tmpDir := filepath.Join(parent, ".tmp-"+suffix)
+		archivePath := tmpDir + ".upload"
 
-		// Always clean up temp artifacts on the way out.
-		defer os.Remove(tmpZipPath)
+		// Always clean up temp artifacts on the way out. Once the upload
+		// becomes a version, tmpDir no longer exists.
+		defer os.Remove(archivePath)
 		defer os.RemoveAll(tmpDir)
 
-		if err := writeBodyToFile(r.Body, tmpZipPath); err != nil {
-			slog.Error("failed to write upload body", "host", host, "error", err)
-			http.Error(w, "failed to write upload", http.StatusInternalServerError)
+		head, err := writeBodyToFile(http.MaxBytesReader(w, r.Body, limits.maxBytes), archivePath)
+		if err != nil {
+			writeUploadBodyError(w, host, err)
+			return
+		}
+
+		format, err := admin.DetectFormat(r.Header.Get("Content-Type"), head)
+		if err != nil {
+			slog.Warn("unrecognized upload format", "host", host, "content_type", r.Header.Get("Content-Type"))
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		report, err := admin.Extract(archivePath, tmpDir, format, limits.extract)
+		if err != nil {
+			slog.Error("failed to extract archive", "host", host, "format", format, "error", err)
+			http.Error(w, "failed to extract archive: "+err.Error(), uploadErrorStatus(err))
 			return
 		}
 
-		if err := os.MkdirAll(tmpDir, 0o755); err != nil {
-			slog.Error("failed to create temp dir", "host", host, "error", err)
+		version, err := versions.Add(tmpDir)
+		if err != nil {
+			slog.Error("failed to activate uploaded version", "host", host, "error", err)
 			http.Error(w, "internal error", http.StatusInternalServerError)
 			return
 		}
 
-		if err := admin.ExtractZip(tmpZipPath, tmpDir); err != nil {
-			slog.Error("failed to extract zip", "host", host, "error", err)
-			status := http.StatusInternalServerError
-			if errors.Is(err, admin.ErrUnsafeEntry) {
-				status = http.StatusBadRequest
-			}
-			http.Error(w, "failed to extract zip: "+err.Error(), status)
+		slog.Info("login assets uploaded",
+			"host", host,
+			"version", version.ID,
+			"format", format,
+			"files", len(report.Files),
+			"bytes", version.Bytes,
+			"stripped_dir", report.StrippedDir,
+			"duration", time.Since(start),
+		)
+		if err := writeJSON(w, admin.UploadResponse{
+			Status:  "ok",
+			Version: version,
+			Report:  report,
+		}); err != nil {
+			slog.Error("failed to write upload response", "error", err)
+		}
+	}
+}
+
+// handlerAdminLoginAssetFilePut replaces or adds a single file, creating a
+// new version from the active one. If another version is activated while
+// the file is written, nothing changes and 409 is returned.
+func handlerAdminLoginAssetFilePut(assets map[string]*admin.Versions, limits uploadLimits) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.PathValue("host")
+		versions, exists := assets[host]
+		if !exists {
+			http.Error(w, "unknown host", http.StatusNotFound)
 			return
 		}
+		name := r.PathValue("path")
 
-		if err := os.RemoveAll(loginDir); err != nil {
-			slog.Error("failed to remove existing login dir", "host", host, "path", loginDir, "error", err)
+		tmpDir, base, err := versions.StagingCopy()
+		if err != nil {
+			slog.Error("failed to stage active version", "host", host, "error", err)
 			http.Error(w, "internal error", http.StatusInternalServerError)
 			return
 		}
+		defer os.RemoveAll(tmpDir)
 
-		if err := os.Rename(tmpDir, loginDir); err != nil {
-			slog.Error("failed to swap login dir", "host", host, "error", err)
+		file, err := admin.WriteFile(tmpDir, name, http.MaxBytesReader(w, r.Body, limits.maxBytes))
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) || !errors.Is(err, admin.ErrInvalidPath) {
+				writeUploadBodyError(w, host, err)
+				return
+			}
+			slog.Warn("invalid login asset path", "host", host, "path", name)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := admin.HasIndex(tmpDir); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		version, err := versions.AddIfActive(tmpDir, base)
+		if errors.Is(err, admin.ErrVersionChanged) {
+			slog.Warn("login asset update raced another change", "host", host, "path", name)
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			slog.Error("failed to activate updated version", "host", host, "error", err)
 			http.Error(w, "internal error", http.StatusInternalServerError)
 			return
 		}
 
-		slog.Info("login assets uploaded",
+		slog.Info("login asset updated",
 			"host", host,
-			"bytes", fileSize(loginDir),
-			"duration", time.Since(start),
+			"version", version.ID,
+			"path", file.Path,
+			"bytes", file.Bytes,
 		)
-		w.Header().Set("Content-Type", "application/json")
-		_, _ = w.Write([]byte(`{"status":"ok"}`))
+		if err := writeJSON(w, admin.UploadResponse{
+			Status:  "ok",
+			Version: version,
+			Report:  &admin.ExtractReport{Files: []admin.ExtractedFile{file}, Bytes: file.Bytes},
+		}); err != nil {
+			slog.Error("failed to write upload response", "error", err)
+		}
 	}
 }
 
-func writeBodyToFile(body io.ReadCloser, path string) error {
-	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
-	if err != nil {
-		return err
+// uploadErrorStatus maps an extraction error to a response status.
+func uploadErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, admin.ErrLimitExceeded):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, admin.ErrUnsafeEntry),
+		errors.Is(err, admin.ErrInvalidArchive),
+		errors.Is(err, admin.ErrMissingIndex):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
 	}
-	defer f.Close()
-	_, err = io.Copy(f, body)
-	return err
 }
 
-func randomSuffix() (string, error) {
-	var b [8]byte
-	if _, err := rand.Read(b[:]); err != nil {
-		return "", err
+// writeUploadBodyError responds to a failure to read an upload body.
+func writeUploadBodyError(w http.ResponseWriter, host string, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		slog.Warn("upload too large", "host", host, "limit", maxBytesErr.Limit)
+		http.Error(w, "upload too large", http.StatusRequestEntityTooLarge)
+		return
 	}
-	return hex.EncodeToString(b[:]), nil
+	slog.Error("failed to write upload body", "host", host, "error", err)
+	http.Error(w, "failed to write upload", http.StatusInternalServerError)
 }
 
-// fileSize returns the total size of the tree rooted at path, for logging.
-// Errors are swallowed — this is best-effort observability.
-func fileSize(root string) int64 {
-	var total int64
-	_ = filepath.Walk(root, func(_ string, info os.FileInfo, err error) error {
-		if err != nil || info == nil {
-			return nil
-		}
-		if !info.IsDir() {
-			total += info.Size()
-		}
-		return nil
-	})
-	return total
+// writeBodyToFile copies body to a new file at path and returns its first
+// bytes, for format detection.
+func writeBodyToFile(body io.ReadCloser, path string) ([]byte, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(body, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	head = head[:n]
+	if _, err := f.Write(head); err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(f, body); err != nil {
+		return nil, err
+	}
+	return head, nil
 }
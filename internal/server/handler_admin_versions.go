@@ -0,0 +1,99 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/iamolegga/lana/internal/admin"
+)
+
+func handlerAdminVersionsList(assets map[string]*admin.Versions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		versions, ok := assets[r.PathValue("host")]
+		if !ok {
+			http.Error(w, "unknown host", http.StatusNotFound)
+			return
+		}
+
+		list, err := versions.List()
+		if err != nil {
+			slog.Error("failed to list login asset versions", "host", r.PathValue("host"), "error", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if err := writeJSON(w, list); err != nil {
+			slog.Error("failed to write versions response", "error", err)
+		}
+	}
+}
+
+func handlerAdminVersionActivate(assets map[string]*admin.Versions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.PathValue("host")
+		versions, id, ok := versionFromPath(w, r, assets)
+		if !ok {
+			return
+		}
+
+		version, err := versions.Activate(id)
+		if err != nil {
+			writeVersionError(w, host, err)
+			return
+		}
+
+		slog.Info("login asset version activated", "host", host, "version", id)
+		if err := writeJSON(w, version); err != nil {
+			slog.Error("failed to write version response", "error", err)
+		}
+	}
+}
+
+func handlerAdminVersionDelete(assets map[string]*admin.Versions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.PathValue("host")
+		versions, id, ok := versionFromPath(w, r, assets)
+		if !ok {
+			return
+		}
+
+		if err := versions.Delete(id); err != nil {
+			writeVersionError(w, host, err)
+			return
+		}
+
+		slog.Info("login asset version deleted", "host", host, "version", id)
+		if err := writeJSON(w, admin.StatusResponse{Status: "ok"}); err != nil {
+			slog.Error("failed to write version response", "error", err)
+		}
+	}
+}
+
+// versionFromPath resolves the {host} and {version} path values, writing an
+// error response when either is invalid.
+func versionFromPath(w http.ResponseWriter, r *http.Request, assets map[string]*admin.Versions) (*admin.Versions, int, bool) {
+	versions, ok := assets[r.PathValue("host")]
+	if !ok {
+		http.Error(w, "unknown host", http.StatusNotFound)
+		return nil, 0, false
+	}
+	id, err := strconv.Atoi(r.PathValue("version"))
+	if err != nil || id <= 0 {
+		http.Error(w, "invalid version", http.StatusBadRequest)
+		return nil, 0, false
+	}
+	return versions, id, true
+}
+
+func writeVersionError(w http.ResponseWriter, host string, err error) {
+	switch {
+	case errors.Is(err, admin.ErrVersionNotFound):
+		http.Error(w, "version not found", http.StatusNotFound)
+	case errors.Is(err, admin.ErrActiveVersion):
+		http.Error(w, "version is active", http.StatusConflict)
+	default:
+		slog.Error("login asset version operation failed", "host", host, "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -10,13 +11,25 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
 	"github.com/iamolegga/lana/internal/metrics"
+	"github.com/iamolegga/lana/internal/oauth"
+	"github.com/iamolegga/lana/internal/tracing"
 )
 
 func (s *Server) handlerCallback(w http.ResponseWriter, r *http.Request) {
-	host, exists := s.hosts[r.Host]
+	ctx, span := tracing.Start(r.Context(), "oauth.callback", trace.WithAttributes(
+		attribute.String("lana.host", r.Host),
+		attribute.String("lana.provider", r.PathValue("provider")),
+	))
+	defer span.End()
+	r = r.WithContext(ctx)
+
+	host, exists := s.host(r.Host)
 	if !exists {
-		http.Error(w, "Unknown host", http.StatusBadRequest)
+		s.renderError(w, r, nil, "", http.StatusBadRequest, "invalid_request", "Unknown host")
 		return
 	}
 
@@ -27,38 +40,37 @@ func (s *Server) handlerCallback(w http.ResponseWriter, r *http.Request) {
 			"provider", providerName,
 			"host", r.Host,
 		)
-		http.NotFound(w, r)
+		s.notFound(w, r, host)
 		return
 	}
 
-	cookie, err := r.Cookie(s.cookieName)
-	if err != nil {
-		slog.Debug("missing state cookie")
-		http.Error(w, "Missing state cookie", http.StatusBadRequest)
+	actualState := r.FormValue("state")
+	if actualState == "" {
+		slog.Debug("missing state parameter")
+		s.renderError(w, r, host, "", http.StatusBadRequest, "invalid_request", "Missing state parameter")
 		return
 	}
 
-	expectedState, redirectURL, codeVerifier, err := decryptState(
-		[]byte(s.cookieSecret),
-		cookie.Value,
-	)
-	if err != nil {
-		slog.Debug("invalid state cookie", "error", err)
-		http.Error(w, "Invalid state cookie", http.StatusBadRequest)
+	flow, cookieName, err := s.loadFlow(r, actualState)
+	switch {
+	case err == nil:
+	case errors.Is(err, errMissingStateCookie):
+		slog.Debug("missing state cookie")
+		s.rateLimiter.Violation(r, "missing_state")
+		s.renderError(w, r, host, "", http.StatusBadRequest, "invalid_request", "Missing state cookie")
 		return
-	}
-
-	if expectedState == "" || redirectURL == "" {
-		slog.Error("missing data in state cookie")
-		http.Error(w, "Invalid state cookie", http.StatusBadRequest)
+	case errors.Is(err, errInvalidStateCookie):
+		slog.Debug("invalid state cookie", "error", err)
+		s.rateLimiter.Violation(r, "invalid_state")
+		s.renderError(w, r, host, "", http.StatusBadRequest, "invalid_request", "Invalid state cookie")
 		return
-	}
-
-	actualState := r.FormValue("state")
-	if actualState != expectedState {
+	case errors.Is(err, errStateMismatch),
+		errors.Is(err, errStateExpired),
+		errors.Is(err, errStateConsumed),
+		isFlowNotFound(err):
 		slog.Debug("state mismatch",
-			"expected", expectedState,
 			"actual", actualState,
+			"error", err,
 		)
 		metrics.RecordAuthentication(
 			providerName,
@@ -66,7 +78,24 @@ func (s *Server) handlerCallback(w http.ResponseWriter, r *http.Request) {
 			"failure",
 			"state_mismatch",
 		)
-		http.Error(w, "State mismatch", http.StatusBadRequest)
+		s.rateLimiter.Violation(r, "state_mismatch")
+		s.renderError(w, r, host, "", http.StatusBadRequest, "invalid_request", "State mismatch")
+		return
+	default:
+		slog.Error("failed to load login flow", "error", err)
+		s.renderError(w, r, host, "", http.StatusInternalServerError, "server_error", "Internal server error")
+		return
+	}
+
+	// The flow is single-use, so its cookie is dropped whatever the outcome.
+	if cookieName != "" {
+		s.deleteStateCookie(w, r, cookieName)
+	}
+
+	redirectURL, codeVerifier := flow.Redirect, flow.CodeVerifier
+	if redirectURL == "" {
+		slog.Error("missing data in login flow")
+		s.renderError(w, r, host, "", http.StatusBadRequest, "invalid_request", "Invalid state cookie")
 		return
 	}
 
@@ -76,23 +105,28 @@ func (s *Server) handlerCallback(w http.ResponseWriter, r *http.Request) {
 			"description", r.FormValue("error_description"),
 		)
 		metrics.RecordAuthentication(providerName, r.Host, "failure", "user_denied")
-		http.Error(w, "Authentication failed: "+errorMsg, http.StatusBadRequest)
+		s.renderError(w, r, host, redirectURL, http.StatusBadRequest, errorMsg, "Authentication failed: %s", errorMsg)
 		return
 	}
 
 	code := r.FormValue("code")
 	if code == "" {
-		http.Error(w, "Missing code parameter", http.StatusBadRequest)
+		s.renderError(w, r, host, redirectURL, http.StatusBadRequest, "invalid_request", "Missing code parameter")
 		return
 	}
 
 	callbackURL := fmt.Sprintf("%s://%s/oauth/callback/%s",
-		getScheme(r),
+		s.clientInfo.Scheme(r),
 		r.Host,
 		providerName,
 	)
 
-	tokens, err := provider.ExchangeCode(r.Context(), code, callbackURL, codeVerifier)
+	exchangeCtx, exchangeSpan := tracing.Start(
+		oauth.WithOperation(r.Context(), providerName, oauth.OperationTokenExchange),
+		"oauth.exchange_code",
+	)
+	tokens, err := provider.ExchangeCode(exchangeCtx, code, callbackURL, codeVerifier)
+	tracing.End(exchangeSpan, err)
 	if err != nil {
 		slog.Debug("token exchange failed", "error", err)
 		metrics.RecordAuthentication(
@@ -101,11 +135,8 @@ func (s *Server) handlerCallback(w http.ResponseWriter, r *http.Request) {
 			"failure",
 			"provider_error",
 		)
-		http.Error(
-			w,
-			"Failed to exchange authorization code",
-			http.StatusBadRequest,
-		)
+		s.rateLimiter.Violation(r, "provider_error")
+		s.renderError(w, r, host, redirectURL, http.StatusBadRequest, "server_error", "Failed to exchange authorization code")
 		return
 	}
 
@@ -113,7 +144,12 @@ func (s *Server) handlerCallback(w http.ResponseWriter, r *http.Request) {
 		tokens.RawUserInfo = userJSON
 	}
 
-	user, err := provider.GetUser(r.Context(), tokens)
+	userCtx, userSpan := tracing.Start(
+		oauth.WithOperation(r.Context(), providerName, oauth.OperationUserInfo),
+		"oauth.get_user",
+	)
+	user, err := provider.GetUser(userCtx, tokens, flow.Nonce)
+	tracing.End(userSpan, err)
 	if err != nil {
 		slog.Debug("failed to get user info", "error", err)
 		metrics.RecordAuthentication(
@@ -122,7 +158,8 @@ func (s *Server) handlerCallback(w http.ResponseWriter, r *http.Request) {
 			"failure",
 			"provider_error",
 		)
-		http.Error(w, "Failed to get user information", http.StatusUnauthorized)
+		s.rateLimiter.Violation(r, "provider_error")
+		s.renderError(w, r, host, redirectURL, http.StatusUnauthorized, "server_error", "Failed to get user information")
 		return
 	}
 
@@ -133,7 +170,7 @@ func (s *Server) handlerCallback(w http.ResponseWriter, r *http.Request) {
 			"failure",
 			"id_missing",
 		)
-		http.Error(w, "User ID not available", http.StatusUnauthorized)
+		s.renderError(w, r, host, redirectURL, http.StatusUnauthorized, "server_error", "User ID not available")
 		return
 	}
 
@@ -141,7 +178,7 @@ func (s *Server) handlerCallback(w http.ResponseWriter, r *http.Request) {
 	sub := hex.EncodeToString(subHash[:])
 
 	jwtClaims := jwt.MapClaims{
-		"iss":         fmt.Sprintf("%s://%s", getScheme(r), r.Host),
+		"iss":         fmt.Sprintf("%s://%s", s.clientInfo.Scheme(r), r.Host),
 		"aud":         host.jwtAudience,
 		"sub":         sub,
 		"provider":    providerName,
@@ -160,30 +197,21 @@ func (s *Server) handlerCallback(w http.ResponseWriter, r *http.Request) {
 	appToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwtClaims)
 	appToken.Header["kid"] = host.jwtKeyID
 
+	_, signSpan := tracing.Start(r.Context(), "jwt.sign")
+	signStart := time.Now()
 	signedToken, err := appToken.SignedString(host.signKey)
+	metrics.RecordJWTSigning(r.Host, time.Since(signStart).Seconds())
+	tracing.End(signSpan, err)
 	if err != nil {
 		slog.Debug("failed to sign JWT", "error", err)
-		http.Error(
-			w,
-			"Failed to create authentication token",
-			http.StatusInternalServerError,
-		)
+		s.renderError(w, r, host, redirectURL, http.StatusInternalServerError, "server_error", "Failed to create authentication token")
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     s.cookieName,
-		Path:     "/",
-		MaxAge:   -1, // Delete the cookie
-		HttpOnly: true,
-		Secure:   isSecure(r),
-		SameSite: http.SameSiteLaxMode,
-	})
-
 	parsedURL, err := url.Parse(redirectURL)
 	if err != nil {
 		slog.Debug("failed to parse redirect URL", "error", err)
-		http.Error(w, "Failed to parse redirect URL", http.StatusBadRequest)
+		s.renderError(w, r, host, "", http.StatusBadRequest, "invalid_request", "Failed to parse redirect URL")
 		return
 	}
 	q := parsedURL.Query()
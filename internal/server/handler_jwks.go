@@ -7,9 +7,9 @@ import (
 )
 
 func (s *Server) handlerJwks(w http.ResponseWriter, r *http.Request) {
-	host, exists := s.hosts[r.Host]
+	host, exists := s.host(r.Host)
 	if !exists {
-		http.Error(w, "Unknown host", http.StatusBadRequest)
+		http.Error(w, s.i18n.Sprintf(r, "Unknown host"), http.StatusBadRequest)
 		return
 	}
 
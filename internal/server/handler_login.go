@@ -5,93 +5,85 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
+	"time"
 
-	"github.com/IGLOU-EU/go-wildcard"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/iamolegga/lana/internal/tracing"
 )
 
 func (s *Server) handlerLogin(w http.ResponseWriter, r *http.Request) {
-	host, exists := s.hosts[r.Host]
+	ctx, span := tracing.Start(r.Context(), "oauth.login", trace.WithAttributes(
+		attribute.String("lana.host", r.Host),
+		attribute.String("lana.provider", r.PathValue("provider")),
+	))
+	defer span.End()
+	r = r.WithContext(ctx)
+
+	host, exists := s.host(r.Host)
 	if !exists {
-		http.Error(w, "Unknown host", http.StatusBadRequest)
+		s.renderError(w, r, nil, "", http.StatusBadRequest, "invalid_request", "Unknown host")
 		return
 	}
 
 	providerName := r.PathValue("provider")
 	provider, providerExists := host.providers[providerName]
 	if !providerExists {
-		http.NotFound(w, r)
+		s.notFound(w, r, host)
 		return
 	}
 
 	redirectURLEncoded := r.URL.Query().Get("redirect")
 	if redirectURLEncoded == "" {
-		http.Error(w, "Missing redirect URL query parameter", http.StatusBadRequest)
+		s.renderError(w, r, host, "", http.StatusBadRequest, "invalid_request", "Missing redirect URL query parameter")
 		return
 	}
 	redirectURL, err := url.QueryUnescape(redirectURLEncoded)
 	if err != nil {
-		http.Error(w, "Invalid redirect URL query parameter", http.StatusBadRequest)
+		s.renderError(w, r, host, "", http.StatusBadRequest, "invalid_request", "Invalid redirect URL query parameter")
 		return
 	}
 
-	allowed := false
-	for _, pattern := range host.allowedRedirectURLs {
-		if wildcard.Match(pattern, redirectURL) {
-			allowed = true
-			break
-		}
-	}
-	if !allowed {
-		http.Error(w, "Redirect URL not allowed", http.StatusBadRequest)
+	if !host.redirectAllowed(redirectURL) {
+		s.renderError(w, r, host, "", http.StatusBadRequest, "invalid_request", "Redirect URL not allowed")
 		return
 	}
 
 	state := generateRandomString(16)
 	if state == "" {
 		slog.Error("failed to generate random state")
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		s.renderError(w, r, host, redirectURL, http.StatusInternalServerError, "server_error", "Internal server error")
 		return
 	}
 
 	callbackURL := fmt.Sprintf("%s://%s/oauth/callback/%s",
-		getScheme(r),
+		s.clientInfo.Scheme(r),
 		r.Host,
 		providerName,
 	)
 
-	authURL, codeVerifier := provider.GetAuthURL(state, callbackURL)
-
-	encryptedState, err := encryptState(
-		[]byte(s.cookieSecret),
-		state,
-		redirectURLEncoded,
-		codeVerifier,
-	)
-	if err != nil {
-		slog.Error("failed to encrypt state data", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	nonce := generateRandomString(32)
+	if nonce == "" {
+		slog.Error("failed to generate random nonce")
+		s.renderError(w, r, host, redirectURL, http.StatusInternalServerError, "server_error", "Internal server error")
 		return
 	}
 
-	sameSite := http.SameSiteLaxMode
-	secure := isSecure(r)
-	if providerName == "apple" {
-		// Apple uses response_mode=form_post, which is a cross-site POST.
-		// SameSite=Lax cookies are not sent on cross-site POST requests,
-		// so we must use SameSite=None (which requires Secure=true).
-		sameSite = http.SameSiteNoneMode
-		secure = true
-	}
+	authURL, codeVerifier := provider.GetAuthURL(state, callbackURL, nonce)
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     s.cookieName,
-		Value:    encryptedState,
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   secure,
-		SameSite: sameSite,
-		MaxAge:   3600,
-	})
+	flow := flowState{
+		State:        state,
+		Redirect:     redirectURLEncoded,
+		CodeVerifier: codeVerifier,
+		Nonce:        nonce,
+		CreatedAt:    time.Now().Unix(),
+	}
+	if err := s.saveFlow(w, r, flow, providerName); err != nil {
+		slog.Error("failed to save login flow", "error", err)
+		s.renderError(w, r, host, redirectURL, http.StatusInternalServerError, "server_error", "Internal server error")
+		return
+	}
 
 	http.Redirect(w, r, authURL, http.StatusFound)
 }
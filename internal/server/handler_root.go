@@ -1,43 +1,82 @@
 package server
 
 import (
+	"errors"
+	"io/fs"
 	"log/slog"
 	"net/http"
+	"path"
 	"path/filepath"
+	"strings"
 )
 
 func (s *Server) handlerRoot(w http.ResponseWriter, r *http.Request) {
-	hostConfig, exists := s.hosts[r.Host]
+	hostConfig, exists := s.host(r.Host)
 	if !exists {
-		http.Error(w, "Unknown host", http.StatusBadRequest)
+		s.renderError(w, r, nil, "", http.StatusBadRequest, "invalid_request", "Unknown host")
 		return
 	}
 
-	path := filepath.Join(hostConfig.loginDir, r.URL.Path)
-
-	info, err := http.Dir(hostConfig.loginDir).Open(r.URL.Path)
-	defer func() {
-		if info != nil {
-			_ = info.Close()
+	if hostConfig.loginDir == "" {
+		if r.URL.Path != "/" && r.URL.Path != "/index.html" {
+			s.notFound(w, r, hostConfig)
+			return
 		}
-	}()
-	if err != nil {
-		slog.Warn("failed to serve", "path", path, "error", err)
-		http.NotFound(w, r)
+		s.renderLoginPage(w, r, hostConfig, defaultLoginPage)
 		return
 	}
 
-	stat, err := info.Stat()
-	if err != nil {
-		slog.Warn("failed to stat login page", "path", path, "error", err)
-		http.NotFound(w, r)
+	name := path.Clean("/" + r.URL.Path)
+	filePath := filepath.Join(hostConfig.loginDir, filepath.FromSlash(name))
+
+	stat, err := statAsset(hostConfig, name)
+	switch {
+	case err == nil && stat.IsDir():
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			target := r.URL.Path + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
+		name = path.Join(name, "index.html")
+		filePath = filepath.Join(filePath, "index.html")
+	case err == nil:
+	case errors.Is(err, fs.ErrNotExist) && hostConfig.spaFallback && path.Ext(name) == "":
+		// Client-side routes like /signup have no file; let the app handle
+		// them. Paths with an extension are missing assets and get a 404.
+		slog.Debug("serving SPA fallback", "path", name)
+		name = "/index.html"
+		filePath = filepath.Join(hostConfig.loginDir, "index.html")
+	default:
+		slog.Warn("failed to serve", "path", filePath, "error", err)
+		s.notFound(w, r, hostConfig)
 		return
 	}
 
-	if stat.IsDir() {
-		path = filepath.Join(path, "index.html")
+	if hostConfig.template && path.Base(name) == "index.html" {
+		tmpl, err := s.templates.get(filePath)
+		if err != nil {
+			slog.Error("failed to load login page template", "path", filePath, "error", err)
+			s.renderError(w, r, hostConfig, "", http.StatusInternalServerError, "server_error", "Internal server error")
+			return
+		}
+		slog.Debug("rendering login page", "path", filePath)
+		s.renderLoginPage(w, r, hostConfig, tmpl)
+		return
 	}
 
-	slog.Debug("serving file", "path", path)
-	http.ServeFile(w, r, path)
+	s.serveAsset(w, r, hostConfig, strings.TrimPrefix(name, "/"))
+}
+
+// statAsset stats name, a clean slash-separated path, in the host's login
+// directory.
+func statAsset(host *hostData, name string) (fs.FileInfo, error) {
+	f, err := http.Dir(host.loginDir).Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Stat()
 }
@@ -0,0 +1,307 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/iamolegga/lana/internal/admin"
+	"github.com/iamolegga/lana/internal/config"
+	"github.com/iamolegga/lana/internal/oauth"
+	"go.yaml.in/yaml/v3"
+)
+
+// Where a host is configured.
+const (
+	hostSourceConfig = "config"
+	hostSourceAPI    = "api"
+)
+
+var (
+	// ErrHostNotFound is returned when removing a host that does not exist.
+	ErrHostNotFound = errors.New("host not found")
+	// ErrHostInConfigFile is returned when changing a host from the config
+	// file at runtime.
+	ErrHostInConfigFile = errors.New("host is defined in the config file")
+	// ErrInvalidHost is returned for a host configuration that fails
+	// validation or cannot be loaded.
+	ErrInvalidHost = errors.New("invalid host")
+)
+
+func newHostData(registry *oauth.Registry, hostname string, hostConfig config.HostConfig) (*hostData, error) {
+	signKey, err := loadSigningKey(hostConfig.JWT.PrivateKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"failed to load signing key for host %s: %w",
+			hostname,
+			err,
+		)
+	}
+
+	providers := make(map[string]oauth.Provider)
+	for providerName, providerConfig := range hostConfig.Providers {
+		provider, err := registry.Create(providerName, &providerConfig)
+		if err != nil {
+			slog.Error("failed to create provider",
+				"provider", providerName,
+				"host", hostname,
+				"error", err,
+			)
+			continue
+		}
+
+		providers[providerName] = provider
+		slog.Info(
+			"initialized provider",
+			"provider",
+			providerName,
+			"host",
+			hostname,
+		)
+	}
+
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("host %s has no providers configured", hostname)
+	}
+
+	expiry, err := time.ParseDuration(hostConfig.JWT.Expiry)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"invalid JWT expiry for host %s: %w",
+			hostname,
+			err,
+		)
+	}
+
+	return &hostData{
+		allowedRedirectURLs: hostConfig.AllowedRedirectURLs,
+		loginDir:            hostConfig.LoginDir,
+		template:            hostConfig.Template,
+		spaFallback:         hostConfig.SPAFallback,
+		branding:            withDefaultBranding(hostConfig.Branding),
+		errorRedirect:       hostConfig.ErrorRedirect,
+		cacheControl:        hostConfig.CacheControl,
+		securityHeaders:     newSecurityHeaders(hostConfig.SecurityHeaders, hostConfig.LoginDir != "" && !hostConfig.Template),
+		jwtAudience:         hostConfig.JWT.Audience,
+		jwtExpiry:           expiry,
+		jwtKeyID:            hostConfig.JWT.KeyID,
+		providers:           providers,
+		signKey:             signKey,
+		config:              hostConfig,
+	}, nil
+}
+
+// host returns the host named name. hostData is never modified once
+// published, so it can be used without holding the lock.
+func (s *Server) host(name string) (*hostData, bool) {
+	s.hostsMu.RLock()
+	defer s.hostsMu.RUnlock()
+	host, ok := s.hosts[name]
+	return host, ok
+}
+
+// LoginDir returns the login directory of a served host, empty when it uses
+// the built-in login page. ok is false when the host is not served.
+func (s *Server) LoginDir(name string) (dir string, ok bool) {
+	host, ok := s.host(name)
+	if !ok {
+		return "", false
+	}
+	return host.loginDir, true
+}
+
+// buildAPIHost validates and loads a host created through the admin API.
+func (s *Server) buildAPIHost(name string, hostConfig config.HostConfig) (*hostData, error) {
+	if err := config.ValidateHost(name, hostConfig); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidHost, err)
+	}
+	host, err := newHostData(s.registry, name, hostConfig)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidHost, err)
+	}
+	host.source = hostSourceAPI
+	return host, nil
+}
+
+func (s *Server) addStoredHost(name string, hostConfig config.HostConfig) error {
+	host, err := s.buildAPIHost(name, hostConfig)
+	if err != nil {
+		return err
+	}
+	if err := s.i18n.SetHostLocale(name, hostConfig.Locale); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidHost, err)
+	}
+	s.hostsMu.Lock()
+	s.hosts[name] = host
+	s.hostsMu.Unlock()
+	return nil
+}
+
+// SetHost creates or replaces a host at runtime. persist is called once the
+// host is valid, before it is served; if it fails nothing changes. Hosts
+// from the config file cannot be replaced. It reports whether the host was
+// created.
+func (s *Server) SetHost(name string, hostConfig config.HostConfig, persist func() error) (bool, error) {
+	host, err := s.buildAPIHost(name, hostConfig)
+	if err != nil {
+		return false, err
+	}
+
+	s.hostStoreMu.Lock()
+	defer s.hostStoreMu.Unlock()
+	s.hostsMu.Lock()
+	defer s.hostsMu.Unlock()
+
+	existing, exists := s.hosts[name]
+	if exists && existing.source == hostSourceConfig {
+		return false, ErrHostInConfigFile
+	}
+	if err := persist(); err != nil {
+		return false, err
+	}
+	if err := s.i18n.SetHostLocale(name, hostConfig.Locale); err != nil {
+		// Validated as a BCP 47 tag above, so this does not happen.
+		slog.Error("failed to set host locale", "host", name, "error", err)
+	}
+	s.hosts[name] = host
+	slog.Info("host updated", "host", name, "created", !exists)
+	return !exists, nil
+}
+
+// RemoveHost removes a host created at runtime. persist is called before the
+// host stops being served; if it fails nothing changes.
+func (s *Server) RemoveHost(name string, persist func() error) error {
+	s.hostStoreMu.Lock()
+	defer s.hostStoreMu.Unlock()
+	s.hostsMu.Lock()
+	defer s.hostsMu.Unlock()
+
+	existing, exists := s.hosts[name]
+	if !exists {
+		return ErrHostNotFound
+	}
+	if existing.source == hostSourceConfig {
+		return ErrHostInConfigFile
+	}
+	if err := persist(); err != nil {
+		return err
+	}
+	delete(s.hosts, name)
+	_ = s.i18n.SetHostLocale(name, "")
+	slog.Info("host removed", "host", name)
+	return nil
+}
+
+// WatchHostStore reloads store every interval until ctx is done, so that
+// hosts created, replaced or removed through another replica sharing the
+// store are served here too.
+func (s *Server) WatchHostStore(ctx context.Context, store *admin.HostStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.syncHostStore(store)
+		}
+	}
+}
+
+// syncHostStore makes the hosts created through the admin API match store.
+// Unchanged hosts are kept as they are; a stored host that fails to load is
+// left as it was and retried on the next sync.
+func (s *Server) syncHostStore(store *admin.HostStore) {
+	s.hostStoreMu.Lock()
+	defer s.hostStoreMu.Unlock()
+
+	stored, err := store.Load()
+	if err != nil {
+		slog.Warn("failed to reload stored hosts", "error", err)
+		return
+	}
+
+	s.hostsMu.RLock()
+	current := maps.Clone(s.hosts)
+	s.hostsMu.RUnlock()
+
+	for name, hostConfig := range stored {
+		existing, exists := current[name]
+		if exists && (existing.source == hostSourceConfig || sameHostConfig(existing.config, hostConfig)) {
+			continue
+		}
+		if err := s.addStoredHost(name, hostConfig); err != nil {
+			slog.Error("failed to load stored host", "host", name, "error", err)
+			continue
+		}
+		slog.Info("host updated from host store", "host", name, "created", !exists)
+	}
+
+	for name, existing := range current {
+		if _, ok := stored[name]; ok || existing.source != hostSourceAPI {
+			continue
+		}
+		s.hostsMu.Lock()
+		delete(s.hosts, name)
+		s.hostsMu.Unlock()
+		_ = s.i18n.SetHostLocale(name, "")
+		slog.Info("host removed from host store", "host", name)
+	}
+}
+
+// sameHostConfig reports whether a and b are stored the same, so that a host
+// decoded from a request and its stored copy compare equal.
+func sameHostConfig(a, b config.HostConfig) bool {
+	encodedA, errA := yaml.Marshal(a)
+	encodedB, errB := yaml.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(encodedA, encodedB)
+}
+
+// HostConfigs returns the configuration of every host being served.
+func (s *Server) HostConfigs() map[string]config.HostConfig {
+	s.hostsMu.RLock()
+	defer s.hostsMu.RUnlock()
+
+	out := make(map[string]config.HostConfig, len(s.hosts))
+	for name, h := range s.hosts {
+		out[name] = h.config
+	}
+	return out
+}
+
+// HostInfo describes the configured hosts, sorted by name, for the admin
+// introspection endpoints.
+func (s *Server) HostInfo() []admin.HostInfo {
+	s.hostsMu.RLock()
+	defer s.hostsMu.RUnlock()
+
+	out := make([]admin.HostInfo, 0, len(s.hosts))
+	for name, h := range s.hosts {
+		providers := slices.Sorted(maps.Keys(h.providers))
+		out = append(out, admin.HostInfo{
+			Name:                name,
+			Source:              h.source,
+			Providers:           providers,
+			AllowedRedirectURLs: h.allowedRedirectURLs,
+			LoginDir:            h.loginDir,
+			Template:            h.template,
+			JWT: admin.JWTInfo{
+				Audience:       h.jwtAudience,
+				Expiry:         h.jwtExpiry.String(),
+				KeyID:          h.jwtKeyID,
+				Algorithm:      "RS256",
+				KeyFingerprint: keyFingerprint(&h.signKey.PublicKey),
+			},
+		})
+	}
+	slices.SortFunc(out, func(a, b admin.HostInfo) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return out
+}
@@ -2,7 +2,9 @@ package server
 
 import (
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/hex"
 	"encoding/pem"
 	"fmt"
 	"os"
@@ -30,3 +32,13 @@ func loadSigningKey(path string) (*rsa.PrivateKey, error) {
 
 	return privKey, nil
 }
+
+// keyFingerprint returns the hex SHA-256 of the DER-encoded public key.
+func keyFingerprint(pub *rsa.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
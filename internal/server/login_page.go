@@ -0,0 +1,196 @@
+package server
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/iamolegga/lana/internal/config"
+	"golang.org/x/text/message"
+)
+
+//go:embed web
+var webFS embed.FS
+
+// defaultLoginPage is served to hosts without a login_dir.
+var defaultLoginPage = template.Must(template.ParseFS(webFS, "web/login.html"))
+
+// defaultBranding fills in whatever a host's branding leaves unset. The
+// title is left out so that it can be translated.
+var defaultBranding = config.Branding{
+	PrimaryColor:    "#1a56db",
+	BackgroundColor: "#f5f5f5",
+	TextColor:       "#1f1f1f",
+}
+
+func withDefaultBranding(b config.Branding) config.Branding {
+	if b.PrimaryColor == "" {
+		b.PrimaryColor = defaultBranding.PrimaryColor
+	}
+	if b.BackgroundColor == "" {
+		b.BackgroundColor = defaultBranding.BackgroundColor
+	}
+	if b.TextColor == "" {
+		b.TextColor = defaultBranding.TextColor
+	}
+	return b
+}
+
+// providerTitles are the display names of the built-in providers.
+var providerTitles = map[string]string{
+	"apple":    "Apple",
+	"facebook": "Facebook",
+	"google":   "Google",
+	"x":        "X",
+}
+
+// pageData is shared by all rendered pages.
+type pageData struct {
+	Host     string
+	Lang     string // negotiated locale, e.g. "de"
+	CSPNonce string // nonce for inline scripts and styles
+	Branding config.Branding
+	printer  *message.Printer
+}
+
+func (s *Server) newPageData(r *http.Request, host *hostData) pageData {
+	printer := s.i18n.Printer(r)
+	data := pageData{
+		Host:     r.Host,
+		Lang:     s.i18n.Locale(r).String(),
+		CSPNonce: cspNonce(r),
+		Branding: defaultBranding,
+		printer:  printer,
+	}
+	if host != nil {
+		data.Branding = host.branding
+	}
+	if data.Branding.Title == "" {
+		data.Branding.Title = printer.Sprintf("Sign in")
+	}
+	return data
+}
+
+// T translates key into the page's locale and formats it with args, e.g.
+// {{.T "Continue with %s" .Title}}.
+func (d pageData) T(key string, args ...any) string {
+	return d.printer.Sprintf(key, args...)
+}
+
+// loginPageData is what templated login pages are rendered with.
+type loginPageData struct {
+	pageData
+	Redirect  string // the redirect URL the page was opened with, if any
+	ErrorCode string // the error query parameter, if it is a known code
+	Error     string // translated message for ErrorCode
+	Providers []loginPageProvider
+}
+
+// loginErrorMessages are the error codes a login page can be opened with,
+// e.g. by an app sending a user back after a failed login, and the messages
+// shown for them. Other values are ignored so that a crafted link cannot put
+// arbitrary text on the login page.
+var loginErrorMessages = map[string]string{
+	"access_denied":   "Sign-in was cancelled. Please try again.",
+	"session_expired": "Your session has expired. Please sign in again.",
+	"server_error":    "Sign-in failed. Please try again.",
+}
+
+type loginPageProvider struct {
+	Name     string // provider key, e.g. "google"
+	Title    string // display name, e.g. "Google"
+	LoginURL string // login URL with the redirect already attached
+}
+
+func (s *Server) newLoginPageData(r *http.Request, host *hostData) loginPageData {
+	query := r.URL.Query()
+	data := loginPageData{
+		pageData: s.newPageData(r, host),
+		Redirect: query.Get("redirect"),
+	}
+	if code := query.Get("error"); loginErrorMessages[code] != "" {
+		data.ErrorCode = code
+		data.Error = data.T(loginErrorMessages[code])
+	}
+
+	for name := range host.providers {
+		loginURL := "/oauth/login/" + url.PathEscape(name)
+		if data.Redirect != "" {
+			loginURL += "?redirect=" + url.QueryEscape(data.Redirect)
+		}
+		title, ok := providerTitles[name]
+		if !ok {
+			title = name
+		}
+		data.Providers = append(data.Providers, loginPageProvider{
+			Name:     name,
+			Title:    title,
+			LoginURL: loginURL,
+		})
+	}
+	sort.Slice(data.Providers, func(i, j int) bool {
+		return data.Providers[i].Name < data.Providers[j].Name
+	})
+
+	return data
+}
+
+type cachedTemplate struct {
+	modTime time.Time
+	tmpl    *template.Template
+}
+
+// templateCache keeps parsed login page templates and reparses a file when
+// its modification time changes, e.g. after an asset upload.
+type templateCache struct {
+	mu        sync.Mutex
+	templates map[string]cachedTemplate // key: file path
+}
+
+func newTemplateCache() *templateCache {
+	return &templateCache{templates: make(map[string]cachedTemplate)}
+}
+
+func (c *templateCache) get(path string) (*template.Template, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cached, ok := c.templates[path]; ok && cached.modTime.Equal(stat.ModTime()) {
+		return cached.tmpl, nil
+	}
+
+	tmpl, err := template.ParseFiles(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse template: %w", err)
+	}
+	c.templates[path] = cachedTemplate{modTime: stat.ModTime(), tmpl: tmpl}
+	return tmpl, nil
+}
+
+// renderLoginPage renders tmpl for the request's host.
+func (s *Server) renderLoginPage(w http.ResponseWriter, r *http.Request, host *hostData, tmpl *template.Template) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, s.newLoginPageData(r, host)); err != nil {
+		slog.Error("failed to render login page", "template", tmpl.Name(), "error", err)
+		http.Error(w, s.i18n.Sprintf(r, "Internal server error"), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// The page depends on the query string, so it must not be cached.
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = buf.WriteTo(w)
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// notFoundPageName is the file in a host's login_dir served with 404s.
+const notFoundPageName = "404.html"
+
+// notFound responds with the host's 404.html when it has one, rendered as a
+// template for templated hosts, and a plain-text body otherwise. host may be
+// nil.
+func (s *Server) notFound(w http.ResponseWriter, r *http.Request, host *hostData) {
+	if host != nil && host.loginDir != "" {
+		path := filepath.Join(host.loginDir, notFoundPageName)
+		page, err := s.notFoundPage(r, host, path)
+		if err == nil {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write(page)
+			return
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			slog.Error("failed to load 404 page", "path", path, "error", err)
+		}
+	}
+
+	http.Error(w, s.i18n.Sprintf(r, "Not Found"), http.StatusNotFound)
+}
+
+func (s *Server) notFoundPage(r *http.Request, host *hostData, path string) ([]byte, error) {
+	if !host.template {
+		return os.ReadFile(path)
+	}
+
+	tmpl, err := s.templates.get(path)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, s.newPageData(r, host)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/iamolegga/lana/internal/config"
+)
+
+// noncePlaceholder in a content security policy is replaced with the
+// response's nonce.
+const noncePlaceholder = "{nonce}"
+
+// defaultSecurityHeaders are sent unless a host overrides them. The CSP only
+// allows same-origin resources plus inline scripts and styles carrying the
+// response's nonce, which is what the built-in pages use. Hosts serving
+// static login pages, which cannot carry the nonce, get no CSP by default.
+var defaultSecurityHeaders = securityHeaders{
+	contentSecurityPolicy: "default-src 'self'; " +
+		"script-src 'self' 'nonce-" + noncePlaceholder + "'; " +
+		"style-src 'self' 'nonce-" + noncePlaceholder + "'; " +
+		"img-src 'self' https: data:; " +
+		"object-src 'none'; base-uri 'none'; frame-ancestors 'none'",
+	frameOptions:            "DENY",
+	referrerPolicy:          "no-referrer",
+	strictTransportSecurity: "max-age=31536000; includeSubDomains",
+	permissionsPolicy:       "camera=(), microphone=(), geolocation=(), payment=(), usb=()",
+}
+
+// securityHeaders are the header values for a host; empty values are not
+// sent.
+type securityHeaders struct {
+	contentSecurityPolicy   string
+	frameOptions            string
+	referrerPolicy          string
+	strictTransportSecurity string
+	permissionsPolicy       string
+}
+
+// newSecurityHeaders applies a host's overrides to the defaults. staticPages
+// is set for hosts serving a login_dir without template: their pages cannot
+// use the nonce, so they keep working unless they set a CSP themselves.
+func newSecurityHeaders(overrides config.SecurityHeaders, staticPages bool) securityHeaders {
+	h := defaultSecurityHeaders
+	if staticPages {
+		h.contentSecurityPolicy = ""
+	}
+	override := func(dst *string, src *string) {
+		if src != nil {
+			*dst = *src
+		}
+	}
+	override(&h.contentSecurityPolicy, overrides.ContentSecurityPolicy)
+	override(&h.frameOptions, overrides.FrameOptions)
+	override(&h.referrerPolicy, overrides.ReferrerPolicy)
+	override(&h.strictTransportSecurity, overrides.StrictTransportSecurity)
+	override(&h.permissionsPolicy, overrides.PermissionsPolicy)
+	return h
+}
+
+type cspNonceKey struct{}
+
+// cspNonce returns the nonce of the response to r, for use in the nonce
+// attribute of inline scripts and styles.
+func cspNonce(r *http.Request) string {
+	nonce, _ := r.Context().Value(cspNonceKey{}).(string)
+	return nonce
+}
+
+// securityHeadersMiddleware sets the security headers of the request's host
+// and makes a fresh CSP nonce available to handlers.
+func (s *Server) securityHeadersMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers := defaultSecurityHeaders
+		if host, ok := s.host(r.Host); ok {
+			headers = host.securityHeaders
+		}
+
+		h := w.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		setIfNotEmpty(h, "X-Frame-Options", headers.frameOptions)
+		setIfNotEmpty(h, "Referrer-Policy", headers.referrerPolicy)
+		setIfNotEmpty(h, "Permissions-Policy", headers.permissionsPolicy)
+		// Browsers ignore HSTS over plain HTTP, so only send it over HTTPS.
+		if s.clientInfo.IsSecure(r) {
+			setIfNotEmpty(h, "Strict-Transport-Security", headers.strictTransportSecurity)
+		}
+
+		if headers.contentSecurityPolicy != "" {
+			nonce, err := newCSPNonce()
+			if err != nil {
+				slog.Error("failed to generate CSP nonce", "error", err)
+				http.Error(w, s.i18n.Sprintf(r, "Internal server error"), http.StatusInternalServerError)
+				return
+			}
+			h.Set("Content-Security-Policy", strings.ReplaceAll(headers.contentSecurityPolicy, noncePlaceholder, nonce))
+			r = r.WithContext(context.WithValue(r.Context(), cspNonceKey{}, nonce))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func newCSPNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+func setIfNotEmpty(h http.Header, key, value string) {
+	if value != "" {
+		h.Set(key, value)
+	}
+}
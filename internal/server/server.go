@@ -8,40 +8,73 @@ import (
 	"log/slog"
 	"net"
 	"strings"
+	"sync"
 
 	"net/http"
 
 	"time"
 
+	"github.com/iamolegga/lana/internal/clientinfo"
 	"github.com/iamolegga/lana/internal/config"
+	"github.com/iamolegga/lana/internal/i18n"
 	"github.com/iamolegga/lana/internal/logging"
 	"github.com/iamolegga/lana/internal/oauth"
 	"github.com/iamolegga/lana/internal/ratelimit"
+	"github.com/iamolegga/lana/internal/statestore"
+	"github.com/iamolegga/lana/internal/tracing"
 )
 
 type hostData struct {
 	allowedRedirectURLs []string
 	loginDir            string
+	template            bool
+	spaFallback         bool
+	branding            config.Branding
+	errorRedirect       bool
+	cacheControl        []config.CacheControlRule
+	securityHeaders     securityHeaders
 	jwtAudience         string
 	jwtExpiry           time.Duration
 	jwtKeyID            string
 	providers           map[string]oauth.Provider
 	signKey             *rsa.PrivateKey
+	config              config.HostConfig
+	source              string // hostSourceConfig or hostSourceAPI
 }
 
 type Server struct {
-	cookieName   string
-	cookieSecret string
-	serverPort   string
-	rateLimiter  ratelimit.Limiter
-	hosts        map[string]*hostData
-	httpServer   *http.Server
+	cookieName  string
+	maxFlows    int
+	stateKeys   *stateKeyring
+	stateStore  statestore.Store // nil keeps flows in cookies
+	consumed    statestore.Store // remembers used states in cookie mode
+	stateTTL    time.Duration
+	bindCookie  bool
+	serverPort  string
+	rateLimiter ratelimit.Limiter
+	clientInfo  *clientinfo.Resolver
+	i18n        *i18n.Bundle
+	registry    *oauth.Registry
+	hostsMu     sync.RWMutex
+	hosts       map[string]*hostData
+	hostStoreMu sync.Mutex // serializes host store writes and syncs
+	templates   *templateCache
+	etags       *etagCache
+	httpServer  *http.Server
 }
 
 type Config struct {
 	Config      config.Config
 	RateLimiter ratelimit.Limiter
 	Registry    *oauth.Registry
+	ClientInfo  *clientinfo.Resolver
+	I18n        *i18n.Bundle
+	// StateStore keeps login flows server-side. Optional: without it flows
+	// are kept in encrypted cookies.
+	StateStore statestore.Store
+	// StoredHosts were created through the admin API. Hosts also in the
+	// config file, and invalid ones, are skipped.
+	StoredHosts map[string]config.HostConfig
 }
 
 func New(cfg Config) (*Server, error) {
@@ -53,73 +86,65 @@ func New(cfg Config) (*Server, error) {
 		return nil, errors.New("OAuth registry is required")
 	}
 
+	if cfg.ClientInfo == nil {
+		return nil, errors.New("client info resolver is required")
+	}
+
+	if cfg.I18n == nil {
+		return nil, errors.New("i18n bundle is required")
+	}
+
 	if len(cfg.Config.Hosts) == 0 {
 		return nil, errors.New("at least one host is required")
 	}
 
 	hosts := make(map[string]*hostData)
 	for hostname, hostConfig := range cfg.Config.Hosts {
-		signKey, err := loadSigningKey(hostConfig.JWT.PrivateKeyFile)
+		host, err := newHostData(cfg.Registry, hostname, hostConfig)
 		if err != nil {
-			return nil, fmt.Errorf(
-				"failed to load signing key for host %s: %w",
-				hostname,
-				err,
-			)
+			return nil, err
 		}
+		host.source = hostSourceConfig
+		hosts[hostname] = host
+	}
 
-		providers := make(map[string]oauth.Provider)
-		for providerName, providerConfig := range hostConfig.Providers {
-			provider, err := cfg.Registry.Create(providerName, &providerConfig)
-			if err != nil {
-				slog.Error("failed to create provider",
-					"provider", providerName,
-					"host", hostname,
-					"error", err,
-				)
-				continue
-			}
-
-			providers[providerName] = provider
-			slog.Info(
-				"initialized provider",
-				"provider",
-				providerName,
-				"host",
-				hostname,
-			)
-		}
+	stateKeys, err := newStateKeyring(cfg.Config.Cookie.Secrets)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cookie secrets: %w", err)
+	}
 
-		if len(providers) == 0 {
-			return nil, fmt.Errorf("host %s has no providers configured", hostname)
-		}
+	server := &Server{
+		cookieName:  cfg.Config.Cookie.Name,
+		maxFlows:    cfg.Config.Cookie.MaxFlows,
+		stateKeys:   stateKeys,
+		stateStore:  cfg.StateStore,
+		consumed:    cfg.StateStore,
+		stateTTL:    cfg.Config.State.TTL,
+		bindCookie:  *cfg.Config.State.BindCookie,
+		serverPort:  cfg.Config.Server.Port,
+		rateLimiter: cfg.RateLimiter,
+		clientInfo:  cfg.ClientInfo,
+		i18n:        cfg.I18n,
+		registry:    cfg.Registry,
+		hosts:       hosts,
+		templates:   newTemplateCache(),
+		etags:       newETagCache(),
+	}
 
-		expiry, err := time.ParseDuration(hostConfig.JWT.Expiry)
-		if err != nil {
-			return nil, fmt.Errorf(
-				"invalid JWT expiry for host %s: %w",
-				hostname,
-				err,
-			)
+	for hostname, hostConfig := range cfg.StoredHosts {
+		if _, exists := hosts[hostname]; exists {
+			slog.Warn("ignoring stored host that is also in the config file", "host", hostname)
+			continue
 		}
-
-		hosts[hostname] = &hostData{
-			allowedRedirectURLs: hostConfig.AllowedRedirectURLs,
-			loginDir:            hostConfig.LoginDir,
-			jwtAudience:         hostConfig.JWT.Audience,
-			jwtExpiry:           expiry,
-			jwtKeyID:            hostConfig.JWT.KeyID,
-			providers:           providers,
-			signKey:             signKey,
+		if err := server.addStoredHost(hostname, hostConfig); err != nil {
+			slog.Error("failed to load stored host", "host", hostname, "error", err)
 		}
 	}
 
-	server := &Server{
-		cookieName:   cfg.Config.Cookie.Name,
-		cookieSecret: cfg.Config.Cookie.Secret,
-		serverPort:   cfg.Config.Server.Port,
-		rateLimiter:  cfg.RateLimiter,
-		hosts:        hosts,
+	if server.consumed == nil {
+		// Without a shared store, replays are only caught by the replica
+		// that served the first callback.
+		server.consumed = statestore.NewMemory(GetServerBaseContext(), time.Minute)
 	}
 
 	addr := fmt.Sprintf(":%s", server.serverPort)
@@ -155,10 +180,17 @@ func (s *Server) GetHTTPServer() *http.Server {
 }
 
 // LoginDirs returns the per-host login directory map. Used to wire the
-// admin upload handler without exposing the full hostData struct.
+// admin upload handler without exposing the full hostData struct. Hosts
+// using the built-in login page are left out.
 func (s *Server) LoginDirs() map[string]string {
+	s.hostsMu.RLock()
+	defer s.hostsMu.RUnlock()
+
 	out := make(map[string]string, len(s.hosts))
 	for name, h := range s.hosts {
+		if h.loginDir == "" {
+			continue
+		}
 		out[name] = h.loginDir
 	}
 	return out
@@ -190,8 +222,11 @@ func (s *Server) setupRoutes() http.Handler {
 	mux.Handle("GET /", withRateLimit(http.HandlerFunc(s.handlerRoot)))
 
 	// Apply middleware in reverse order (last applied is executed first)
-	handler := logging.Middleware(mux)
+	handler := s.i18n.Middleware(mux)
+	handler = s.securityHeadersMiddleware(handler)
+	handler = logging.Middleware(handler)
 	handler = metricsMiddleware(handler, classifyPublicPath)
+	handler = tracing.Middleware(handler, classifyPublicPath)
 
 	return handler
 }
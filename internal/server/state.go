@@ -3,82 +3,149 @@ package server
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hkdf"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
+
+	"github.com/iamolegga/lana/internal/metrics"
+)
+
+const (
+	// stateKeyInfo and stateKeyIDInfo separate the encryption key and the
+	// public key ID derived from the same cookie secret.
+	stateKeyInfo   = "lana state cookie encryption v1"
+	stateKeyIDInfo = "lana state cookie key id v1"
 )
 
-type stateCookie struct {
+// flowState is what the callback needs to know about a login flow. It is
+// kept either in the flow's state cookie or in the server-side state store.
+type flowState struct {
 	State        string `json:"state"`
-	Redirect     string `json:"redirect"`
+	Redirect     string `json:"redirect,omitempty"`
 	CodeVerifier string `json:"code_verifier,omitempty"`
+	Nonce        string `json:"nonce,omitempty"`
+	CreatedAt    int64  `json:"created_at"` // unix seconds
 }
 
-func encryptState(key []byte, state, redirect, codeVerifier string) (string, error) {
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return "", fmt.Errorf("could not create cipher: %w", err)
+type stateKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// stateKeyring encrypts state cookies with the first key and decrypts them
+// with whichever key the cookie names, so secrets can be rotated without
+// breaking logins in flight. Cookies look like "<key id>.<base64 sealed box>".
+type stateKeyring struct {
+	keys []stateKey
+}
+
+// newStateKeyring derives an AES-256-GCM key and a key ID from each secret
+// with HKDF-SHA256, so secrets may be of any length.
+func newStateKeyring(secrets []string) (*stateKeyring, error) {
+	if len(secrets) == 0 {
+		return nil, errors.New("at least one cookie secret is required")
 	}
 
-	aesGCM, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", fmt.Errorf("could not create GCM: %w", err)
+	ring := &stateKeyring{}
+	seen := make(map[string]bool, len(secrets))
+	for i, secret := range secrets {
+		key, err := hkdf.Key(sha256.New, []byte(secret), nil, stateKeyInfo, 32)
+		if err != nil {
+			return nil, fmt.Errorf("could not derive key for cookie secret %d: %w", i, err)
+		}
+		rawID, err := hkdf.Key(sha256.New, []byte(secret), nil, stateKeyIDInfo, 4)
+		if err != nil {
+			return nil, fmt.Errorf("could not derive key id for cookie secret %d: %w", i, err)
+		}
+		id := hex.EncodeToString(rawID)
+		if seen[id] {
+			return nil, fmt.Errorf("cookie secret %d is a duplicate", i)
+		}
+		seen[id] = true
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("could not create cipher: %w", err)
+		}
+		aesGCM, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("could not create GCM: %w", err)
+		}
+
+		ring.keys = append(ring.keys, stateKey{id: id, aead: aesGCM})
 	}
+	return ring, nil
+}
+
+func (k *stateKeyring) encrypt(data flowState) (string, error) {
+	key := k.keys[0]
 
-	nonce := make([]byte, aesGCM.NonceSize())
+	nonce := make([]byte, key.aead.NonceSize())
 	if _, err := rand.Read(nonce); err != nil {
 		return "", fmt.Errorf("could not generate nonce: %w", err)
 	}
 
-	data := stateCookie{
-		State:        state,
-		Redirect:     redirect,
-		CodeVerifier: codeVerifier,
-	}
-
 	plaintext, err := json.Marshal(data)
 	if err != nil {
 		return "", fmt.Errorf("could not marshal state data: %w", err)
 	}
 
-	ciphertext := aesGCM.Seal(nonce, nonce, plaintext, nil)
+	ciphertext := key.aead.Seal(nonce, nonce, plaintext, []byte(key.id))
 
-	return base64.RawURLEncoding.EncodeToString(ciphertext), nil
+	return key.id + "." + base64.RawURLEncoding.EncodeToString(ciphertext), nil
 }
 
-func decryptState(key []byte, encryptedData string) (state, redirect, codeVerifier string, err error) {
-	ciphertext, err := base64.RawURLEncoding.DecodeString(encryptedData)
-	if err != nil {
-		return "", "", "", fmt.Errorf("could not decode base64: %w", err)
+func (k *stateKeyring) decrypt(encryptedData string) (flowState, error) {
+	id, encoded, found := strings.Cut(encryptedData, ".")
+	if !found {
+		return flowState{}, decryptFailure("malformed", errors.New("missing key id"))
 	}
 
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return "", "", "", fmt.Errorf("could not create cipher: %w", err)
+	var key *stateKey
+	for i := range k.keys {
+		if k.keys[i].id == id {
+			key = &k.keys[i]
+			break
+		}
+	}
+	if key == nil {
+		// E.g. a cookie set before its secret was retired.
+		return flowState{}, decryptFailure("unknown_key", fmt.Errorf("unknown key id %q", id))
 	}
 
-	aesGCM, err := cipher.NewGCM(block)
+	ciphertext, err := base64.RawURLEncoding.DecodeString(encoded)
 	if err != nil {
-		return "", "", "", fmt.Errorf("could not create GCM: %w", err)
+		return flowState{}, decryptFailure("malformed", fmt.Errorf("could not decode base64: %w", err))
 	}
 
-	if len(ciphertext) < aesGCM.NonceSize() {
-		return "", "", "", errors.New("ciphertext too short")
+	if len(ciphertext) < key.aead.NonceSize() {
+		return flowState{}, decryptFailure("malformed", errors.New("ciphertext too short"))
 	}
 
-	nonce, ciphertext := ciphertext[:aesGCM.NonceSize()], ciphertext[aesGCM.NonceSize():]
+	nonce, ciphertext := ciphertext[:key.aead.NonceSize()], ciphertext[key.aead.NonceSize():]
 
-	plaintext, err := aesGCM.Open(nil, nonce, ciphertext, nil)
+	plaintext, err := key.aead.Open(nil, nonce, ciphertext, []byte(key.id))
 	if err != nil {
-		return "", "", "", fmt.Errorf("could not decrypt: %w", err)
+		return flowState{}, decryptFailure("authentication", fmt.Errorf("could not decrypt: %w", err))
 	}
 
-	var data stateCookie
+	var data flowState
 	if err := json.Unmarshal(plaintext, &data); err != nil {
-		return "", "", "", fmt.Errorf("could not unmarshal state data: %w", err)
+		return flowState{}, decryptFailure("payload", fmt.Errorf("could not unmarshal state data: %w", err))
 	}
 
-	return data.State, data.Redirect, data.CodeVerifier, nil
+	return data, nil
+}
+
+// decryptFailure counts a state cookie that could not be decrypted and
+// returns err.
+func decryptFailure(reason string, err error) error {
+	metrics.RecordStateDecryptFailure(reason)
+	return err
 }
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Every login flow gets its own state cookie, named after its state value,
+// so logins started in parallel (other tabs, other providers) don't
+// overwrite each other.
+func (s *Server) stateCookieName(state string) string {
+	return s.cookieName + "_" + state
+}
+
+// setStateCookie stores an encrypted flow state for the callback.
+func (s *Server) setStateCookie(w http.ResponseWriter, r *http.Request, state, value, providerName string) {
+	sameSite := http.SameSiteLaxMode
+	secure := s.clientInfo.IsSecure(r)
+	if providerName == "apple" {
+		// Apple uses response_mode=form_post, which is a cross-site POST.
+		// SameSite=Lax cookies are not sent on cross-site POST requests,
+		// so we must use SameSite=None (which requires Secure=true).
+		sameSite = http.SameSiteNoneMode
+		secure = true
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.stateCookieName(state),
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: sameSite,
+		MaxAge:   int(s.stateTTL.Seconds()),
+	})
+}
+
+// deleteStateCookie expires the cookie with the given name.
+func (s *Server) deleteStateCookie(w http.ResponseWriter, r *http.Request, name string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Path:     "/",
+		MaxAge:   -1, // Delete the cookie
+		HttpOnly: true,
+		Secure:   s.clientInfo.IsSecure(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// pruneStateCookies makes room for a new flow: it deletes state cookies that
+// are unreadable or expired, then the oldest ones until fewer than
+// s.maxFlows remain, so abandoned logins can't grow the Cookie header
+// without bound.
+func (s *Server) pruneStateCookies(w http.ResponseWriter, r *http.Request) {
+	type flow struct {
+		name      string
+		createdAt int64
+	}
+
+	prefix := s.cookieName + "_"
+	cutoff := time.Now().Add(-s.stateTTL).Unix()
+
+	var flows []flow
+	for _, c := range r.Cookies() {
+		if !strings.HasPrefix(c.Name, prefix) {
+			continue
+		}
+		data, err := s.stateKeys.decrypt(c.Value)
+		if err != nil || data.CreatedAt < cutoff {
+			s.deleteStateCookie(w, r, c.Name)
+			continue
+		}
+		flows = append(flows, flow{name: c.Name, createdAt: data.CreatedAt})
+	}
+
+	if excess := len(flows) - s.maxFlows + 1; excess > 0 {
+		sort.Slice(flows, func(i, j int) bool {
+			return flows[i].createdAt < flows[j].createdAt
+		})
+		for _, f := range flows[:excess] {
+			slog.Debug("dropping oldest login flow", "cookie", f.name)
+			s.deleteStateCookie(w, r, f.name)
+		}
+	}
+}
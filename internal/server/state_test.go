@@ -0,0 +1,140 @@
+package server
+
+import (
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+const (
+	oldSecret = "0123456789abcdef-old"
+	newSecret = "0123456789abcdef-new"
+)
+
+func mustKeyring(t *testing.T, secrets ...string) *stateKeyring {
+	t.Helper()
+	ring, err := newStateKeyring(secrets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ring
+}
+
+func mustEncrypt(t *testing.T, ring *stateKeyring, data flowState) string {
+	t.Helper()
+	cookie, err := ring.encrypt(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cookie
+}
+
+func TestStateKeyringRoundTrip(t *testing.T) {
+	ring := mustKeyring(t, newSecret)
+	want := flowState{
+		State:        "s1",
+		Redirect:     "https://app.example.com/cb",
+		CodeVerifier: "verifier",
+		Nonce:        "nonce",
+		CreatedAt:    1700000000,
+	}
+
+	cookie := mustEncrypt(t, ring, want)
+	if other := mustEncrypt(t, ring, want); other == cookie {
+		t.Error("two encryptions of the same state are identical")
+	}
+
+	got, err := ring.decrypt(cookie)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("decrypt = %+v, want %+v", got, want)
+	}
+}
+
+func TestStateKeyringKeyID(t *testing.T) {
+	raw, err := hkdf.Key(sha256.New, []byte(newSecret), nil, stateKeyIDInfo, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantID := hex.EncodeToString(raw)
+
+	// The ID depends only on the secret, so every replica agrees on it.
+	for _, ring := range []*stateKeyring{mustKeyring(t, newSecret), mustKeyring(t, newSecret, oldSecret)} {
+		cookie := mustEncrypt(t, ring, flowState{State: "s"})
+		if id, _, _ := strings.Cut(cookie, "."); id != wantID {
+			t.Errorf("key id = %q, want %q", id, wantID)
+		}
+	}
+	if mustKeyring(t, oldSecret).keys[0].id == wantID {
+		t.Error("different secrets share a key id")
+	}
+}
+
+func TestStateKeyringRotation(t *testing.T) {
+	before := mustKeyring(t, oldSecret)
+	during := mustKeyring(t, newSecret, oldSecret)
+	after := mustKeyring(t, newSecret)
+
+	// A login started before the rotation completes during it.
+	oldCookie := mustEncrypt(t, before, flowState{State: "old"})
+	if got, err := during.decrypt(oldCookie); err != nil || got.State != "old" {
+		t.Fatalf("decrypt with the old secret still listed: %+v, %v", got, err)
+	}
+
+	// New logins use the first secret, which the old replicas do not know yet
+	// but every replica knows once the rotation is done.
+	newCookie := mustEncrypt(t, during, flowState{State: "new"})
+	if _, err := before.decrypt(newCookie); err == nil {
+		t.Error("a replica without the new secret decrypted a new cookie")
+	}
+	if got, err := after.decrypt(newCookie); err != nil || got.State != "new" {
+		t.Errorf("decrypt after the rotation: %+v, %v", got, err)
+	}
+
+	// Once the old secret is retired, its cookies are rejected.
+	if _, err := after.decrypt(oldCookie); err == nil || !strings.Contains(err.Error(), "unknown key id") {
+		t.Errorf("decrypt with a retired secret: %v, want an unknown key id", err)
+	}
+}
+
+func TestStateKeyringRejectsTampering(t *testing.T) {
+	ring := mustKeyring(t, newSecret, oldSecret)
+	cookie := mustEncrypt(t, ring, flowState{State: "s"})
+	id, encoded, _ := strings.Cut(cookie, ".")
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flipped := append([]byte(nil), sealed...)
+	flipped[len(flipped)-1] ^= 1
+
+	tests := map[string]string{
+		"empty":             "",
+		"no key id":         encoded,
+		"bad base64":        id + ".!!!",
+		"too short":         id + "." + base64.RawURLEncoding.EncodeToString(sealed[:4]),
+		"modified":          id + "." + base64.RawURLEncoding.EncodeToString(flipped),
+		"other key's id":    ring.keys[1].id + "." + encoded,
+		"unknown key id":    "00000000." + encoded,
+		"sealed by another": mustEncrypt(t, mustKeyring(t, "0123456789abcdef-other"), flowState{State: "s"}),
+	}
+	for name, value := range tests {
+		if got, err := ring.decrypt(value); err == nil {
+			t.Errorf("%s: decrypted to %+v", name, got)
+		}
+	}
+}
+
+func TestNewStateKeyringErrors(t *testing.T) {
+	if _, err := newStateKeyring(nil); err == nil {
+		t.Error("no secrets accepted")
+	}
+	if _, err := newStateKeyring([]string{newSecret, oldSecret, newSecret}); err == nil || !strings.Contains(err.Error(), "secret 2 is a duplicate") {
+		t.Errorf("duplicate secret: %v", err)
+	}
+}
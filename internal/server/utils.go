@@ -8,26 +8,6 @@ import (
 	"net/http"
 )
 
-func getScheme(r *http.Request) string {
-	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
-		return proto
-	}
-
-	if scheme := r.Header.Get("X-Scheme"); scheme != "" {
-		return scheme
-	}
-
-	if r.TLS != nil {
-		return "https"
-	}
-
-	return "http"
-}
-
-func isSecure(r *http.Request) bool {
-	return getScheme(r) == "https"
-}
-
 func generateRandomString(length int) string {
 	if length <= 0 {
 		return ""
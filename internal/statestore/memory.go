@@ -0,0 +1,93 @@
+package statestore
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// Memory keeps state in process memory. It only works with a single replica
+// (or sticky sessions), and state is lost on restart.
+type Memory struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+}
+
+// NewMemory returns an in-memory store that sweeps expired entries every
+// cleanupInterval until ctx is done.
+func NewMemory(ctx context.Context, cleanupInterval time.Duration) *Memory {
+	m := &Memory{entries: make(map[string]memoryEntry)}
+	go m.cleanupLoop(ctx, cleanupInterval)
+	return m
+}
+
+func (m *Memory) Put(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.entries[key] = memoryEntry{value: value, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+func (m *Memory) Take(_ context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	delete(m.entries, key)
+	if time.Now().After(entry.expiresAt) {
+		return nil, ErrNotFound
+	}
+	return entry.value, nil
+}
+
+func (m *Memory) Claim(_ context.Context, key string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if entry, ok := m.entries[key]; ok && now.Before(entry.expiresAt) {
+		return false, nil
+	}
+	m.entries[key] = memoryEntry{expiresAt: now.Add(ttl)}
+	return true, nil
+}
+
+func (m *Memory) cleanupLoop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.cleanup()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (m *Memory) cleanup() {
+	now := time.Now()
+	removed := 0
+
+	m.mu.Lock()
+	for key, entry := range m.entries {
+		if now.After(entry.expiresAt) {
+			delete(m.entries, key)
+			removed++
+		}
+	}
+	m.mu.Unlock()
+
+	slog.Debug("cleaned up expired states", "store", "memory", "removed", removed)
+}
@@ -0,0 +1,72 @@
+package statestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// takeScript is GETDEL for servers older than Redis 6.2.
+var takeScript = redis.NewScript(`
+local value = redis.call("GET", KEYS[1])
+if value then
+  redis.call("DEL", KEYS[1])
+end
+return value
+`)
+
+// Redis keeps state in a Redis-protocol store shared by all replicas. Expiry
+// is handled by the store itself.
+type Redis struct {
+	client  redis.Cmdable
+	prefix  string
+	timeout time.Duration
+}
+
+// NewRedis returns a store using client. Keys are namespaced with prefix;
+// each call is bounded by timeout.
+func NewRedis(client redis.Cmdable, prefix string, timeout time.Duration) *Redis {
+	return &Redis{
+		client:  client,
+		prefix:  prefix,
+		timeout: timeout,
+	}
+}
+
+func (s *Redis) Put(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	if err := s.client.Set(ctx, s.prefix+key, value, ttl).Err(); err != nil {
+		return fmt.Errorf("set state: %w", err)
+	}
+	return nil
+}
+
+func (s *Redis) Take(ctx context.Context, key string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	value, err := takeScript.Run(ctx, s.client, []string{s.prefix + key}).Text()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("take state: %w", err)
+	}
+	return []byte(value), nil
+}
+
+func (s *Redis) Claim(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	claimed, err := s.client.SetNX(ctx, s.prefix+key, 1, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("claim state: %w", err)
+	}
+	return claimed, nil
+}
@@ -0,0 +1,114 @@
+package statestore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+)
+
+// SQLite keeps state in a local database file. Replicas share state only if
+// they share the file, so it suits single-node deployments that must survive
+// restarts.
+type SQLite struct {
+	db *sql.DB
+}
+
+// NewSQLite opens (creating if needed) the database at path and sweeps
+// expired entries every cleanupInterval until ctx is done.
+func NewSQLite(ctx context.Context, path string, cleanupInterval time.Duration) (*SQLite, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite database %s: %w", path, err)
+	}
+	// SQLite allows a single writer; serialize in the pool instead of
+	// failing with SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS oauth_states (
+			key        TEXT PRIMARY KEY,
+			value      BLOB NOT NULL,
+			expires_at INTEGER NOT NULL
+		)`); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("create sqlite schema in %s: %w", path, err)
+	}
+
+	s := &SQLite{db: db}
+	go s.cleanupLoop(ctx, cleanupInterval)
+	return s, nil
+}
+
+func (s *SQLite) Put(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO oauth_states (key, value, expires_at) VALUES (?, ?, ?)`,
+		key, value, time.Now().Add(ttl).UnixMilli(),
+	)
+	if err != nil {
+		return fmt.Errorf("insert state: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLite) Take(ctx context.Context, key string) ([]byte, error) {
+	var value []byte
+	err := s.db.QueryRowContext(ctx,
+		`DELETE FROM oauth_states WHERE key = ? AND expires_at > ? RETURNING value`,
+		key, time.Now().UnixMilli(),
+	).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("take state: %w", err)
+	}
+	return value, nil
+}
+
+func (s *SQLite) Claim(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	// Take over the key only if it is absent or expired.
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO oauth_states (key, value, expires_at) VALUES (?, x'', ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at
+		WHERE oauth_states.expires_at <= ?`,
+		key, now.Add(ttl).UnixMilli(), now.UnixMilli(),
+	)
+	if err != nil {
+		return false, fmt.Errorf("claim state: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("claim state: %w", err)
+	}
+	return affected == 1, nil
+}
+
+func (s *SQLite) cleanupLoop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			res, err := s.db.ExecContext(ctx,
+				`DELETE FROM oauth_states WHERE expires_at <= ?`,
+				time.Now().UnixMilli(),
+			)
+			if err != nil {
+				slog.Warn("failed to clean up expired states", "store", "sqlite", "error", err)
+				continue
+			}
+			removed, _ := res.RowsAffected()
+			slog.Debug("cleaned up expired states", "store", "sqlite", "removed", removed)
+		case <-ctx.Done():
+			_ = s.db.Close()
+			return
+		}
+	}
+}
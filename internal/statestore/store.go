@@ -0,0 +1,26 @@
+// Package statestore keeps OAuth flow state on the server side, so only an
+// opaque handle has to travel through the browser.
+package statestore
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned by Take when the key never existed, has expired,
+// or was already taken.
+var ErrNotFound = errors.New("state not found")
+
+// Store is a key-value store with expiry and single-use reads.
+// Implementations must be safe for concurrent use.
+type Store interface {
+	// Put stores value under key for ttl.
+	Put(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Take atomically returns and deletes the value stored under key, so a
+	// value can be consumed at most once even across replicas.
+	Take(ctx context.Context, key string) ([]byte, error)
+	// Claim marks key as used for ttl. It reports false if key was already
+	// claimed and has not expired.
+	Claim(ctx context.Context, key string, ttl time.Duration) (bool, error)
+}